@@ -0,0 +1,37 @@
+package certs
+
+import (
+	"k8s.io/apimachinery/pkg/fields"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewObjectCache creates a cache restricted to the object with the name in the namespace and adds it to the manager.
+// The cache is started on all replicas, independent of the leader election.
+func NewObjectCache(mgr ctrl.Manager, namespace, name string, obj client.Object) (cache.Cache, error) {
+	c, err := cache.New(mgr.GetConfig(), cache.Options{
+		Scheme:            mgr.GetScheme(),
+		Mapper:            mgr.GetRESTMapper(),
+		DefaultNamespaces: map[string]cache.Config{namespace: {}},
+		ByObject: map[client.Object]cache.ByObject{
+			obj: {Field: fields.OneTermEqualSelector("metadata.name", name)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.Add(objectCache{Cache: c}); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// objectCache is added to the caches of the manager, which are started on all replicas
+type objectCache struct {
+	cache.Cache
+}
+
+func (c objectCache) GetCache() cache.Cache {
+	return c.Cache
+}
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/bakito/operator-utils/pkg/certs/metrics"
+	"github.com/bakito/operator-utils/pkg/log"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// caState the result of a CA check
+type caState struct {
+	key  crypto.Signer
+	cert *x509.Certificate
+	// changed the CA data of the secret was changed
+	changed bool
+	// renewed the signing CA was changed
+	renewed     bool
+	requeue     time.Duration
+	annotations map[string]interface{}
+}
+
+func (s *caState) setPhaseStart(t *time.Time) {
+	s.changed = true
+	if t == nil {
+		s.annotations = map[string]interface{}{certs.CARotationAnnotation: nil}
+	} else {
+		s.annotations = map[string]interface{}{certs.CARotationAnnotation: t.Format(time.RFC3339Nano)}
+	}
+}
+
+// reconcileWithCA keeps the CA and re-signs the server certificate with the existing CA if needed.
+// The CA is rotated if it is missing, invalid or about to expire.
+// deferred is true if a due renewal of the server certificate is deferred to the switch to the next CA.
+func (r *reconciler) reconcileWithCA(
+	ctx context.Context,
+	certLog logr.Logger,
+	secret *corev1.Secret,
+	recreate bool,
+) (reconcile.Result, bool, error) {
+	caSecret := secret
+	if r.opts.CASecretName != "" {
+		caSecret = &corev1.Secret{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: r.nn.Namespace, Name: r.opts.CASecretName}, caSecret)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return reconcile.Result{}, false, err
+			}
+			if !r.opts.CreateSecret {
+				certLog.Error(err, "could not find ca secret", "ca-secret", r.opts.CASecretName)
+				return reconcile.Result{}, false, nil
+			}
+			caSecret = r.newSecret(r.opts.CASecretName, false)
+		}
+	}
+	if caSecret.Data == nil {
+		caSecret.Data = map[string][]byte{}
+	}
+
+	ca, err := r.rotateCA(certLog, caSecret)
+	if err != nil {
+		return reconcile.Result{}, false, err
+	}
+
+	data := map[string][]byte{}
+	var annotations map[string]interface{}
+	caBundle := caSecret.Data[r.opts.CACert]
+	if caSecret != secret {
+		if ca.changed {
+			if err := r.saveSecret(ctx, caSecret, ca.annotations); err != nil {
+				return reconcile.Result{}, false, err
+			}
+		}
+		if !bytes.Equal(secret.Data[r.opts.CACert], caBundle) {
+			data[r.opts.CACert] = caBundle
+		}
+	} else if ca.changed {
+		data[r.opts.CACert] = caBundle
+		data[r.opts.CAKey] = caSecret.Data[r.opts.CAKey]
+		data[certs.CANextKey] = caSecret.Data[certs.CANextKey]
+		annotations = ca.annotations
+	}
+
+	// while the next CA is published, the server certificate is renewed with the switch to the next CA.
+	// Re-signing it with the old CA would not extend its validity beyond the old CA.
+	deferred := recreate && !ca.renewed && len(caSecret.Data[certs.CANextKey]) > 0 &&
+		r.validateCertsBefore(secret, 0) == nil
+	if deferred {
+		certLog.V(1).Info("Deferring the certificate renewal to the switch to the next CA")
+		recreate = false
+	}
+
+	if recreate || ca.renewed {
+		log.With(certLog, secret).Info("Recreating certificates")
+		serverKey, serverCert, err := r.createServerCert(ca.key, ca.cert, time.Now().Add(r.opts.CertValidity))
+		if err != nil {
+			return reconcile.Result{}, false, err
+		}
+		data[r.opts.ServerKey] = serverKey
+		data[r.opts.ServerCert] = serverCert
+	}
+
+	if len(data) > 0 {
+		secret.Data = data
+		if err := r.saveSecret(ctx, secret, annotations); err != nil {
+			return reconcile.Result{}, false, err
+		}
+	}
+	if recreate || ca.renewed {
+		r.recordRotation(secret, metrics.RotationServer)
+	}
+	if ca.renewed {
+		r.recordRotation(secret, metrics.RotationCA)
+	}
+	return reconcile.Result{RequeueAfter: ca.requeue}, deferred, nil
+}
+
+// rotateCA checks the CA and handles the phases of a CA rotation. The data of the CA secret is updated in place.
+//
+// A rotation is started UpdateBefore plus two grace periods before the CA expires, so it is completed
+// before the server certificates signed by the old CA are due:
+//  1. a new CA is created and added to the CA bundle, the server certificate is still signed by the old CA.
+//  2. after the grace period, the new CA becomes the signing CA and the server certificate is re-signed.
+//  3. after another grace period, the old CA is removed from the CA bundle.
+func (r *reconciler) rotateCA(certLog logr.Logger, caSecret *corev1.Secret) (*caState, error) {
+	now := time.Now()
+	ca := &caState{}
+	caBundle := caSecret.Data[r.opts.CACert]
+
+	var err error
+	ca.key, ca.cert, err = r.parseCA(caBundle, caSecret.Data[r.opts.CAKey])
+	if err != nil {
+		certLog.Info("CA is invalid", "reason", err.Error())
+		return ca, r.newCA(certLog, caSecret, ca)
+	}
+
+	caCerts, err := parseCertificates(caBundle)
+	if err != nil {
+		return nil, err
+	}
+
+	nextKeyPEM := caSecret.Data[certs.CANextKey]
+	if len(nextKeyPEM) == 0 && len(caCerts) == 1 {
+		if rotationStart := r.rotationStart(ca.cert); now.Before(rotationStart) {
+			ca.requeue = rotationStart.Sub(now)
+			return ca, nil
+		}
+
+		certLog.Info("CA is about to expire, starting CA rotation", "notAfter", ca.cert.NotAfter)
+		nextKey, _, nextCertPEM, err := r.createCA(now.Add(r.opts.CAValidity))
+		if err != nil {
+			return nil, err
+		}
+		nextKeyPEM, err = encodeKey(nextKey)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding CA key: %w", err)
+		}
+		caSecret.Data[r.opts.CACert] = append(encodeCertificate(ca.cert), nextCertPEM...)
+		caSecret.Data[certs.CANextKey] = nextKeyPEM
+		ca.setPhaseStart(&now)
+		ca.requeue = r.opts.CARotationGracePeriod
+		return ca, nil
+	}
+
+	phaseStart, err := time.Parse(time.RFC3339Nano, caSecret.GetAnnotations()[certs.CARotationAnnotation])
+	if err != nil {
+		// the start of the phase is unknown, restart the grace period
+		ca.setPhaseStart(&now)
+		ca.requeue = r.opts.CARotationGracePeriod
+		return ca, nil
+	}
+	if wait := phaseStart.Add(r.opts.CARotationGracePeriod).Sub(now); wait > 0 {
+		ca.requeue = wait
+		return ca, nil
+	}
+
+	if len(nextKeyPEM) > 0 {
+		nextKey, nextCert, err := r.parseCA(caBundle, nextKeyPEM)
+		if err != nil {
+			certLog.Info("Next CA is invalid, restarting CA rotation", "reason", err.Error())
+			caSecret.Data[r.opts.CACert] = encodeCertificate(ca.cert)
+			caSecret.Data[certs.CANextKey] = nil
+			ca.setPhaseStart(nil)
+			ca.requeue = time.Second
+			return ca, nil
+		}
+
+		log.With(certLog, caSecret).Info("Switching to the next CA")
+		caSecret.Data[r.opts.CAKey] = nextKeyPEM
+		caSecret.Data[certs.CANextKey] = nil
+		ca.key = nextKey
+		ca.cert = nextCert
+		ca.renewed = true
+		ca.setPhaseStart(&now)
+		ca.requeue = r.opts.CARotationGracePeriod
+		return ca, nil
+	}
+
+	log.With(certLog, caSecret).Info("Removing the old CA from the CA bundle")
+	caSecret.Data[r.opts.CACert] = encodeCertificate(ca.cert)
+	ca.setPhaseStart(nil)
+	ca.requeue = time.Until(r.rotationStart(ca.cert))
+	return ca, nil
+}
+
+// newCA creates a new CA replacing the current one without any overlap
+func (r *reconciler) newCA(certLog logr.Logger, caSecret *corev1.Secret, ca *caState) error {
+	log.With(certLog, caSecret).Info("Recreating CA")
+	caKey, caCert, caCertPEM, err := r.createCA(time.Now().Add(r.opts.CAValidity))
+	if err != nil {
+		return err
+	}
+	caKeyPEM, err := encodeKey(caKey)
+	if err != nil {
+		return fmt.Errorf("error encoding CA key: %w", err)
+	}
+
+	caSecret.Data[r.opts.CACert] = caCertPEM
+	caSecret.Data[r.opts.CAKey] = caKeyPEM
+	caSecret.Data[certs.CANextKey] = nil
+	ca.key = caKey
+	ca.cert = caCert
+	ca.renewed = true
+	ca.requeue = time.Until(r.rotationStart(caCert))
+	ca.setPhaseStart(nil)
+	return nil
+}
+
+// rotationStart returns the time the rotation of the CA starts.
+// UpdateBefore plus two grace periods before the CA expires, so the rotation is completed before
+// the server certificates signed by the CA are due.
+func (r *reconciler) rotationStart(caCert *x509.Certificate) time.Time {
+	return caCert.NotAfter.Add(-r.opts.UpdateBefore - 2*r.opts.CARotationGracePeriod)
+}
@@ -1,14 +1,15 @@
 package controller
 
 import (
+	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
 	"time"
 )
 
@@ -21,30 +22,50 @@ func (r *reconciler) createCertTemplate(notAfter time.Time) (*x509.Certificate,
 		return nil, errors.New("failed to generate serial number: " + err.Error())
 	}
 
-	serviceName := r.nn.Name + "." + r.nn.Namespace
-	commonName := serviceName + ".svc"
-	serviceNames := []string{
-		r.nn.Name,
-		serviceName,
-		commonName,
-		serviceName + ".svc.cluster.local",
-	}
-
 	tmpl := x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
 			Organization: []string{r.opts.Organization},
-			CommonName:   commonName,
+			CommonName:   r.commonName(),
 		},
-		SignatureAlgorithm:    x509.SHA256WithRSA,
+		SignatureAlgorithm:    r.signatureAlgorithm(),
 		NotBefore:             time.Now(),
 		NotAfter:              notAfter,
 		BasicConstraintsValid: true,
-		DNSNames:              serviceNames,
+		DNSNames:              r.dnsNames(),
+		IPAddresses:           r.ipAddresses(),
 	}
 	return &tmpl, nil
 }
 
+// commonName the common name of the certificates
+func (r *reconciler) commonName() string {
+	return r.opts.ServiceName + "." + r.nn.Namespace + ".svc"
+}
+
+// dnsNames the DNS names of the certificates
+func (r *reconciler) dnsNames() []string {
+	commonName := r.commonName()
+	serviceNames := []string{
+		r.opts.ServiceName,
+		r.opts.ServiceName + "." + r.nn.Namespace,
+		commonName,
+		commonName + "." + r.opts.ClusterDomain,
+	}
+	return append(serviceNames, r.opts.DNSNames...)
+}
+
+// ipAddresses the IP addresses of the certificates
+func (r *reconciler) ipAddresses() []net.IP {
+	var ips []net.IP
+	for _, ip := range r.opts.IPAddresses {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			ips = append(ips, parsed)
+		}
+	}
+	return ips
+}
+
 // Create cert template suitable for CA and hence signing
 func (r *reconciler) createCACertTemplate(notAfter time.Time) (*x509.Certificate, error) {
 	rootCert, err := r.createCertTemplate(notAfter)
@@ -86,8 +107,8 @@ func createCert(template, parent *x509.Certificate, pub interface{}, parentPriv
 	return
 }
 
-func (r *reconciler) createCA(notAfter time.Time) (*rsa.PrivateKey, *x509.Certificate, []byte, error) {
-	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+func (r *reconciler) createCA(notAfter time.Time) (crypto.Signer, *x509.Certificate, []byte, error) {
+	rootKey, err := r.generateKey()
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("error generating random key: %w", err)
 	}
@@ -97,7 +118,7 @@ func (r *reconciler) createCA(notAfter time.Time) (*rsa.PrivateKey, *x509.Certif
 		return nil, nil, nil, fmt.Errorf("error generating CA cert: %w", err)
 	}
 
-	rootCert, rootCertPEM, err := createCert(rootCertTmpl, rootCertTmpl, &rootKey.PublicKey, rootKey)
+	rootCert, rootCertPEM, err := createCert(rootCertTmpl, rootCertTmpl, rootKey.Public(), rootKey)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("error signing the CA cert: %w", err)
 	}
@@ -107,32 +128,103 @@ func (r *reconciler) createCA(notAfter time.Time) (*rsa.PrivateKey, *x509.Certif
 // CreateCerts creates and returns a CA certificate and certificate and
 // key for the server. serverKey and serverCert are used by the server
 // to establish trust for clients, CA certificate is used by the
-// client to verify the server authentication chain. notAfter specifies
-// the expiration date.
-func (r *reconciler) createCerts(notAfter time.Time) (serverKey, serverCert, caCert []byte, err error) {
+// client to verify the server authentication chain. The expiration
+// dates are defined by the CA and cert validity options.
+func (r *reconciler) createCerts() (serverKey, serverCert, caCert []byte, err error) {
 	// First create a CA certificate and private key
-	caKey, caCertificate, caCertificatePEM, err := r.createCA(notAfter)
+	caKey, caCertificate, caCertificatePEM, err := r.createCA(time.Now().Add(r.opts.CAValidity))
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	// Then create the private key for the serving cert
-	servKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	servKeyPEM, servCertPEM, err := r.createServerCert(caKey, caCertificate, time.Now().Add(r.opts.CertValidity))
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("error generating random key: %w", err)
+		return nil, nil, nil, err
+	}
+	return servKeyPEM, servCertPEM, caCertificatePEM, nil
+}
+
+// createServerCert creates the certificate and key for the server signed by the given CA.
+// The certificate does not outlive the CA.
+func (r *reconciler) createServerCert(caKey crypto.Signer, caCertificate *x509.Certificate, notAfter time.Time) (
+	serverKey, serverCert []byte, err error,
+) {
+	if caCertificate.NotAfter.Before(notAfter) {
+		notAfter = caCertificate.NotAfter
+	}
+
+	// create the private key for the serving cert
+	servKey, err := r.generateKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating random key: %w", err)
 	}
 	servCertTemplate, err := r.createServerCertTemplate(notAfter)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to create the server certificate template: %w", err)
+		return nil, nil, fmt.Errorf("failed to create the server certificate template: %w", err)
 	}
 
 	// create a certificate which wraps the server's public key, sign it with the CA private key
-	_, servCertPEM, err := createCert(servCertTemplate, caCertificate, &servKey.PublicKey, caKey)
+	_, servCertPEM, err := createCert(servCertTemplate, caCertificate, servKey.Public(), caKey)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("error signing server certificate template: %w", err)
+		return nil, nil, fmt.Errorf("error signing server certificate template: %w", err)
 	}
-	servKeyPEM := pem.EncodeToMemory(&pem.Block{
-		Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(servKey),
-	})
-	return servKeyPEM, servCertPEM, caCertificatePEM, nil
+	servKeyPEM, err := encodeKey(servKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding server key: %w", err)
+	}
+	return servKeyPEM, servCertPEM, nil
+}
+
+// parseCA parses the CA private key and finds the matching CA certificate in the CA bundle
+func (r *reconciler) parseCA(caBundlePEM, caKeyPEM []byte) (crypto.Signer, *x509.Certificate, error) {
+	keyBlock, _ := pem.Decode(caKeyPEM)
+	if keyBlock == nil {
+		return nil, nil, errors.New("failed to decode the CA key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing the CA key: %w", err)
+	}
+	caKey, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("the CA key can not be used for signing")
+	}
+	if !r.matchesKeyAlgorithm(caKey.Public()) {
+		return nil, nil, fmt.Errorf("the CA key does not match the key algorithm %q", r.opts.KeyAlgorithm)
+	}
+
+	caCerts, err := parseCertificates(caBundlePEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing the CA bundle: %w", err)
+	}
+	for _, caCert := range caCerts {
+		if pub, ok := caCert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && pub.Equal(caKey.Public()) {
+			if !caCert.IsCA {
+				return nil, nil, errors.New("the CA certificate is not a CA")
+			}
+			return caKey, caCert, nil
+		}
+	}
+	return nil, nil, errors.New("the CA bundle does not contain a certificate for the CA key")
+}
+
+// parseCertificates parses all PEM encoded certificates
+func parseCertificates(certsPEM []byte) ([]*x509.Certificate, error) {
+	var result []*x509.Certificate
+	for block, rest := pem.Decode(certsPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, cert)
+	}
+	return result, nil
+}
+
+// encodeCertificate encodes the certificate as PEM
+func encodeCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
 }
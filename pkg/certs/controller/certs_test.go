@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Certs", func() {
+	var r *reconciler
+
+	BeforeEach(func() {
+		r = &reconciler{
+			nn: types.NamespacedName{Namespace: "test-ns", Name: "test-name"},
+		}
+	})
+
+	DescribeTable("createCerts",
+		func(alg certs.KeyAlgorithm, size int, sigAlg x509.SignatureAlgorithm) {
+			o := certs.Options{KeyAlgorithm: alg, KeySize: size}
+			r.opts = o.ApplyDefaults(r.nn.Name)
+
+			serverKey, serverCert, caCert, err := r.createCerts()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			block, _ := pem.Decode(serverKey)
+			Ω(block).ShouldNot(BeNil())
+			Ω(block.Type).Should(Equal("PRIVATE KEY"))
+			_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pair, err := tls.X509KeyPair(serverCert, serverKey)
+			Ω(err).ShouldNot(HaveOccurred())
+			cert, err := x509.ParseCertificate(pair.Certificate[0])
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(cert.SignatureAlgorithm).Should(Equal(sigAlg))
+
+			pool := x509.NewCertPool()
+			Ω(pool.AppendCertsFromPEM(caCert)).Should(BeTrue())
+			_, err = cert.Verify(x509.VerifyOptions{Roots: pool, DNSName: "test-name.test-ns.svc"})
+			Ω(err).ShouldNot(HaveOccurred())
+		},
+		Entry("RSA", certs.RSA, 0, x509.SHA256WithRSA),
+		Entry("ECDSA P-256", certs.ECDSA, 256, x509.ECDSAWithSHA256),
+		Entry("ECDSA P-384", certs.ECDSA, 384, x509.ECDSAWithSHA384),
+		Entry("Ed25519", certs.Ed25519, 0, x509.PureEd25519),
+	)
+
+	It("should use the configured service name, domain and SANs", func() {
+		o := certs.Options{
+			ServiceName:   "webhook",
+			ClusterDomain: "example.com",
+			DNSNames:      []string{"webhook.example.org"},
+			IPAddresses:   []string{"10.0.0.1"},
+			CertValidity:  24 * time.Hour,
+			UpdateBefore:  time.Hour,
+		}
+		r.opts = o.ApplyDefaults(r.nn.Name)
+
+		_, serverCert, _, err := r.createCerts()
+		Ω(err).ShouldNot(HaveOccurred())
+		cert, err := parseCertificates(serverCert)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(cert[0].Subject.CommonName).Should(Equal("webhook.test-ns.svc"))
+		Ω(cert[0].DNSNames).Should(ConsistOf(
+			"webhook",
+			"webhook.test-ns",
+			"webhook.test-ns.svc",
+			"webhook.test-ns.svc.example.com",
+			"webhook.example.org",
+		))
+		Ω(cert[0].IPAddresses).Should(HaveLen(1))
+		Ω(cert[0].IPAddresses[0].String()).Should(Equal("10.0.0.1"))
+		Ω(cert[0].NotAfter).Should(BeTemporally("~", time.Now().Add(24*time.Hour), time.Minute))
+	})
+
+	It("should fail with an unsupported key size", func() {
+		r.opts = certs.Options{KeyAlgorithm: certs.ECDSA, KeySize: 123}
+		_, _, _, err := r.createCerts()
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should fail with an unsupported key algorithm", func() {
+		r.opts = certs.Options{KeyAlgorithm: "DSA"}
+		_, _, _, err := r.createCerts()
+		Ω(err).Should(HaveOccurred())
+	})
+})
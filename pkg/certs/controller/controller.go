@@ -2,25 +2,41 @@ package controller
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
+	"maps"
+	"math/rand"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/bakito/operator-utils/pkg/certs/metrics"
+	"github.com/bakito/operator-utils/pkg/certs/watcher"
 	"github.com/bakito/operator-utils/pkg/log"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // Reconciler interface
 type Reconciler interface {
 	SetupWithManager(globalMgr, namespacedMgr ctrl.Manager) error
+	// NextRenewal returns the time of the next planned renewal of the server certificate.
+	// The zero time is returned if no valid certificate was reconciled yet.
+	NextRenewal() time.Time
+	// SecretChecker returns a checker verifying that the secret holds a valid, unexpired key pair signed by the CA
+	SecretChecker() healthz.Checker
+	// CertDirChecker returns a checker verifying that the files in the cert dir match the secret
+	CertDirChecker() healthz.Checker
+	// InjectionChecker returns a checker verifying that all ca injection targets carry the current ca cert
+	InjectionChecker() healthz.Checker
 }
 
 // reconciler reconciles a ClusterRole object
@@ -29,6 +45,13 @@ type reconciler struct {
 	log  logr.Logger
 	nn   types.NamespacedName
 	opts certs.Options
+
+	watcherOptions []watcher.Option
+	watcher        watcher.Watcher
+	recorder       record.EventRecorder
+
+	mux         sync.RWMutex
+	nextRenewal time.Time
 }
 
 func (r *reconciler) logger() logr.Logger {
@@ -36,7 +59,11 @@ func (r *reconciler) logger() logr.Logger {
 }
 
 // +kubebuilder:rbac:groups=,resources=secret,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=,resources=configmaps,verbs=get;list;watch
 // +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations;validatingwebhookconfigurations,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=apiregistration.k8s.io,resources=apiservices,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=,resources=events,verbs=create;patch
 
 func (r *reconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
 	certLog := r.logger()
@@ -45,41 +72,31 @@ func (r *reconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result
 	secret := &corev1.Secret{}
 	err := r.Get(ctx, r.nn, secret)
 	if err != nil {
-		if errors.IsNotFound(err) {
+		if !errors.IsNotFound(err) {
+			// Error reading the object - requeue the request.
+			return reconcile.Result{}, err
+		}
+		if !r.opts.CreateSecret {
 			certLog.Error(err, "could not find cert secret")
 			return reconcile.Result{}, nil
 		}
-		// Error reading the object - requeue the request.
-		return reconcile.Result{}, err
+		secret = r.newSecret(r.nn.Name, true)
 	}
 
-	recreate := true
+	recreate := !r.certsValid(certLog, secret)
 
-	if _, haskey := secret.Data[r.opts.ServerKey]; !haskey {
-		certLog.WithValues("cert", r.opts.ServerKey).Info("Certificate secret is missing key")
-	} else if _, haskey := secret.Data[r.opts.ServerCert]; !haskey {
-		certLog.WithValues("cert", r.opts.ServerCert).Info("Certificate secret is missing key")
-	} else if _, haskey := secret.Data[r.opts.CACert]; !haskey {
-		certLog.WithValues("cert", r.opts.CACert).Info("Certificate secret is missing key")
-	} else {
-		// Check the expiration date of the certificate to see if it needs to be updated
-		cert, err := tls.X509KeyPair(secret.Data[r.opts.ServerCert], secret.Data[r.opts.ServerKey])
+	if r.opts.KeepCA {
+		res, deferred, err := r.reconcileWithCA(ctx, certLog, secret, recreate)
 		if err != nil {
-			certLog.Error(err, "Error creating pem from certificate and key")
-		} else {
-			certData, err := x509.ParseCertificate(cert.Certificate[0])
-			if err != nil {
-				certLog.Error(err, "Error parsing certificate")
-			} else if time.Now().Add(r.opts.UpdateBefore).Before(certData.NotAfter) {
-				recreate = false
-			}
+			return res, err
 		}
+		return r.finish(certLog, secret, res, deferred)
 	}
 
 	if recreate {
 		l := log.With(certLog, secret)
 		l.Info("Recreating certificates")
-		serverKey, serverCert, caCert, err := r.createCerts(time.Now().AddDate(1, 0, 0))
+		serverKey, serverCert, caCert, err := r.createCerts()
 		if err != nil {
 			return reconcile.Result{}, err
 		}
@@ -89,16 +106,128 @@ func (r *reconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result
 			r.opts.ServerCert: serverCert,
 			r.opts.CACert:     caCert,
 		}
-		err = r.patchSecret(ctx, secret)
-		return reconcile.Result{}, err
+		if err = r.saveSecret(ctx, secret, nil); err != nil {
+			return reconcile.Result{}, err
+		}
+		r.recordRotation(secret, metrics.RotationServer)
+		r.recordRotation(secret, metrics.RotationCA)
+	}
+	return r.finish(certLog, secret, reconcile.Result{}, false)
+}
+
+// finish records the metrics and schedules the next renewal.
+// If the renewal is deferred, it is done with the requeue of the CA rotation.
+func (r *reconciler) finish(
+	certLog logr.Logger,
+	secret *corev1.Secret,
+	res reconcile.Result,
+	deferred bool,
+) (ctrl.Result, error) {
+	r.recordCertMetrics(secret)
+	if deferred {
+		r.mux.Lock()
+		r.nextRenewal = time.Now().Add(res.RequeueAfter)
+		r.mux.Unlock()
+		return res, nil
+	}
+	return r.scheduleRenewal(certLog, secret, res), nil
+}
+
+// scheduleRenewal requeues the request at the renewal time of the server certificate, unless the result
+// requeues earlier (e.g. at the start of a CA rotation).
+// A jitter of up to 10% of UpdateBefore is added to not renew all certificates at the same time.
+func (r *reconciler) scheduleRenewal(certLog logr.Logger, secret *corev1.Secret, res reconcile.Result) reconcile.Result {
+	serverCerts, err := parseCertificates(secret.Data[r.opts.ServerCert])
+	if err != nil || len(serverCerts) == 0 {
+		certLog.Info("Could not schedule the certificate renewal")
+		return res
+	}
+	renewal := serverCerts[0].NotAfter.Add(-r.opts.UpdateBefore)
+
+	r.mux.Lock()
+	r.nextRenewal = renewal
+	r.mux.Unlock()
+
+	requeue := time.Until(renewal)
+	if requeue < time.Second {
+		requeue = time.Second
+	}
+	if maxJitter := int64(r.opts.UpdateBefore / 10); maxJitter > 0 {
+		requeue += time.Duration(rand.Int63n(maxJitter)) //nolint:gosec
+	}
+	if res.RequeueAfter == 0 || requeue < res.RequeueAfter {
+		res.RequeueAfter = requeue
+	}
+	certLog.V(1).Info("Next certificate renewal scheduled", "renewal", renewal)
+	return res
+}
+
+// NextRenewal returns the time of the next planned renewal of the server certificate
+func (r *reconciler) NextRenewal() time.Time {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.nextRenewal
+}
+
+// certsValid checks if the secret contains a valid key pair that does not have to be updated yet
+func (r *reconciler) certsValid(certLog logr.Logger, secret *corev1.Secret) bool {
+	if err := r.validateCerts(secret); err != nil {
+		certLog.Info("Certificates have to be recreated", "reason", err.Error())
+		return false
+	}
+	return true
+}
+
+// newSecret creates a new secret object that is created on save
+func (r *reconciler) newSecret(name string, tls bool) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       r.nn.Namespace,
+			Name:            name,
+			Labels:          maps.Clone(r.opts.SecretLabels),
+			Annotations:     maps.Clone(r.opts.SecretAnnotations),
+			OwnerReferences: slices.Clone(r.opts.SecretOwnerReferences),
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+	if tls && r.opts.ServerKey == corev1.TLSPrivateKeyKey && r.opts.ServerCert == corev1.TLSCertKey {
+		secret.Type = corev1.SecretTypeTLS
+	}
+	return secret
+}
+
+// saveSecret creates a new secret or patches the data and annotations of an existing one
+func (r *reconciler) saveSecret(ctx context.Context, secret *corev1.Secret, annotations map[string]interface{}) error {
+	if secret.ResourceVersion != "" {
+		return r.patchSecret(ctx, secret, annotations)
+	}
+
+	for k, v := range secret.Data {
+		if v == nil {
+			delete(secret.Data, k)
+		}
 	}
-	return reconcile.Result{}, nil
+	for k, v := range annotations {
+		if value, ok := v.(string); ok {
+			if secret.Annotations == nil {
+				secret.Annotations = map[string]string{}
+			}
+			secret.Annotations[k] = value
+		}
+	}
+	log.With(r.logger(), secret).Info("Creating secret")
+	return r.Create(ctx, secret)
 }
 
-func (r *reconciler) patchSecret(ctx context.Context, secret *corev1.Secret) error {
+func (r *reconciler) patchSecret(ctx context.Context, secret *corev1.Secret, annotations map[string]interface{}) error {
 	patch := map[string]interface{}{
 		"data": secret.Data,
 	}
+	if len(annotations) > 0 {
+		patch["metadata"] = map[string]interface{}{
+			"annotations": annotations,
+		}
+	}
 
 	mergePatch, err := json.Marshal(patch)
 	if err != nil {
@@ -0,0 +1,342 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/bakito/operator-utils/pkg/certs/metrics"
+	"github.com/bakito/operator-utils/pkg/certs/watcher"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Controller", func() {
+	var (
+		r      *reconciler
+		ctx    context.Context
+		secret *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test-ns", Name: "test-name"},
+		}
+		r = New(logr.Discard(), secret.Namespace, secret.Name, certs.Options{}).(*reconciler)
+	})
+
+	It("should take the client and watcher options from the options", func() {
+		c := fake.NewClientBuilder().Build()
+		r = New(logr.Discard(), secret.Namespace, secret.Name, certs.Options{},
+			WithClient(c),
+			WithWatcherOptions(watcher.WithLogger(logr.Discard())),
+		).(*reconciler)
+		Ω(r.Client).Should(BeIdenticalTo(c))
+		Ω(r.watcherOptions).Should(HaveLen(1))
+	})
+
+	getSecret := func(name string) *corev1.Secret {
+		s := &corev1.Secret{}
+		Ω(r.Get(ctx, types.NamespacedName{Namespace: secret.Namespace, Name: name}, s)).ShouldNot(HaveOccurred())
+		return s
+	}
+
+	Context("Reconcile", func() {
+		BeforeEach(func() {
+			r.Client = fake.NewClientBuilder().WithObjects(secret).Build()
+		})
+
+		It("should create the certs", func() {
+			recorder := record.NewFakeRecorder(10)
+			r.recorder = recorder
+
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(recorder.Events).Should(Receive(Equal("Normal CertificateRotated Server certificate was renewed")))
+			Ω(recorder.Events).Should(Receive(Equal("Normal CertificateRotated CA was renewed")))
+
+			s := getSecret(secret.Name)
+			Ω(s.Data).Should(HaveKey(certs.ServerKey))
+			Ω(s.Data).Should(HaveKey(certs.ServerCert))
+			Ω(s.Data).Should(HaveKey(certs.CACert))
+			Ω(s.Data).ShouldNot(HaveKey(certs.CAKey))
+		})
+
+		It("should not recreate valid certs", func() {
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			s1 := getSecret(secret.Name)
+
+			_, err = r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			s2 := getSecret(secret.Name)
+
+			Ω(s2.Data).Should(Equal(s1.Data))
+		})
+
+		It("should write the certs into the cert dir on secret events", func() {
+			r.opts.WriteCertDir = true
+			r.opts.CertDir = filepath.Join(GinkgoT().TempDir(), "certs")
+
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = os.Stat(r.opts.CertDir)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+
+			informers := &informertest.FakeInformers{}
+			writerCtx, cancel := context.WithCancel(ctx)
+			cancel()
+			Ω((&certDirWriter{r: r, cache: informers}).Start(writerCtx)).ShouldNot(HaveOccurred())
+			informer, err := informers.FakeInformerFor(ctx, &corev1.Secret{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			s := getSecret(secret.Name)
+			informer.Add(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: secret.Namespace, Name: "other"}})
+			informer.Add(s)
+			for _, key := range []string{certs.ServerKey, certs.ServerCert, certs.CACert} {
+				data, err := os.ReadFile(filepath.Join(r.opts.CertDir, key))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(data).Should(Equal(s.Data[key]))
+			}
+			entries, err := os.ReadDir(r.opts.CertDir)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(HaveLen(3))
+		})
+
+		It("should record the metrics", func() {
+			rotations := metrics.Rotations.WithLabelValues(secret.Namespace, secret.Name, metrics.RotationServer)
+			before := testutil.ToFloat64(rotations)
+
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(testutil.ToFloat64(rotations)).Should(Equal(before + 1))
+			Ω(testutil.ToFloat64(metrics.CertNotAfter.WithLabelValues(secret.Namespace, secret.Name))).
+				Should(BeNumerically("~", time.Now().Add(certs.OneYear).Unix(), 60))
+			Ω(testutil.ToFloat64(metrics.CANotAfter.WithLabelValues(secret.Namespace, secret.Name))).
+				Should(BeNumerically("~", time.Now().Add(certs.FiveYears).Unix(), 60))
+
+			Ω(metrics.RegisterRenewal(secret.Namespace, secret.Name, r.NextRenewal)).ShouldNot(HaveOccurred())
+			Ω(metrics.RegisterRenewal(secret.Namespace, secret.Name, r.NextRenewal)).ShouldNot(HaveOccurred())
+		})
+
+		It("should requeue at the renewal time", func() {
+			Ω(r.NextRenewal()).Should(BeZero())
+
+			res, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			renewal := time.Now().Add(certs.OneYear - certs.OneWeek)
+			Ω(r.NextRenewal()).Should(BeTemporally("~", renewal, time.Minute))
+			Ω(res.RequeueAfter).Should(BeNumerically(">=", time.Until(renewal)-time.Minute))
+			Ω(res.RequeueAfter).Should(BeNumerically("<=", time.Until(renewal)+certs.OneWeek/10))
+		})
+	})
+
+	Context("CreateSecret", func() {
+		BeforeEach(func() {
+			r.Client = fake.NewClientBuilder().Build()
+		})
+
+		It("should not create the secret by default", func() {
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			s := &corev1.Secret{}
+			err = r.Get(ctx, types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}, s)
+			Ω(errors.IsNotFound(err)).Should(BeTrue())
+		})
+
+		It("should create a tls secret", func() {
+			r.opts.CreateSecret = true
+			r.opts.SecretLabels = map[string]string{"foo": "bar"}
+			r.opts.SecretAnnotations = map[string]string{"bar": "foo"}
+			r.opts.SecretOwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: "operator", UID: "uid",
+			}}
+
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			s := getSecret(secret.Name)
+			Ω(s.Type).Should(Equal(corev1.SecretTypeTLS))
+			Ω(s.Labels).Should(Equal(r.opts.SecretLabels))
+			Ω(s.Annotations).Should(Equal(r.opts.SecretAnnotations))
+			Ω(s.OwnerReferences).Should(Equal(r.opts.SecretOwnerReferences))
+			Ω(s.Data).Should(HaveKey(certs.ServerKey))
+			Ω(s.Data).Should(HaveKey(certs.ServerCert))
+			Ω(s.Data).Should(HaveKey(certs.CACert))
+		})
+
+		It("should create an opaque secret with custom key names", func() {
+			r.opts.CreateSecret = true
+			r.opts.ServerKey = "server.key"
+
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			s := getSecret(secret.Name)
+			Ω(s.Type).Should(Equal(corev1.SecretTypeOpaque))
+			Ω(s.Data).Should(HaveKey("server.key"))
+		})
+
+		It("should create the secrets with a separate CA secret", func() {
+			r.opts.CreateSecret = true
+			r.opts.KeepCA = true
+			r.opts.CASecretName = "test-ca"
+
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			s := getSecret(secret.Name)
+			ca := getSecret(r.opts.CASecretName)
+			Ω(s.Type).Should(Equal(corev1.SecretTypeTLS))
+			Ω(ca.Type).Should(Equal(corev1.SecretTypeOpaque))
+			Ω(ca.Data).Should(HaveKey(certs.CAKey))
+			Ω(s.Data[certs.CACert]).Should(Equal(ca.Data[certs.CACert]))
+		})
+	})
+
+	Context("KeepCA", func() {
+		BeforeEach(func() {
+			r.opts.KeepCA = true
+			r.Client = fake.NewClientBuilder().WithObjects(secret).Build()
+		})
+
+		It("should keep the CA when the server cert is recreated", func() {
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			s1 := getSecret(secret.Name)
+			Ω(s1.Data).Should(HaveKey(certs.CAKey))
+
+			s1.Data[certs.ServerCert] = []byte("invalid")
+			Ω(r.Update(ctx, s1)).ShouldNot(HaveOccurred())
+
+			_, err = r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			s2 := getSecret(secret.Name)
+			Ω(s2.Data[certs.CACert]).Should(Equal(s1.Data[certs.CACert]))
+			Ω(s2.Data[certs.CAKey]).Should(Equal(s1.Data[certs.CAKey]))
+			Ω(s2.Data[certs.ServerCert]).ShouldNot(Equal(s1.Data[certs.ServerCert]))
+		})
+
+		It("should store the CA in a separate secret", func() {
+			caSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: secret.Namespace, Name: "test-ca"},
+			}
+			r.opts.CASecretName = caSecret.Name
+			r.Client = fake.NewClientBuilder().WithObjects(secret, caSecret).Build()
+
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			s := getSecret(secret.Name)
+			ca := getSecret(caSecret.Name)
+			Ω(s.Data).ShouldNot(HaveKey(certs.CAKey))
+			Ω(ca.Data).Should(HaveKey(certs.CAKey))
+			Ω(s.Data[certs.CACert]).Should(Equal(ca.Data[certs.CACert]))
+		})
+
+		It("should rotate the CA with an overlapping CA bundle", func() {
+			r.opts.CARotationGracePeriod = time.Millisecond
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			s0 := getSecret(secret.Name)
+
+			By("adding the next CA to the bundle")
+			r.opts.UpdateBefore = 10 * 365 * 24 * time.Hour
+			_, err = r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			r.opts.UpdateBefore = certs.OneWeek
+			s1 := getSecret(secret.Name)
+			Ω(s1.Annotations).Should(HaveKey(certs.CARotationAnnotation))
+			Ω(s1.Data).Should(HaveKey(certs.CANextKey))
+			Ω(s1.Data[certs.CAKey]).Should(Equal(s0.Data[certs.CAKey]))
+			Ω(s1.Data[certs.CACert]).Should(HavePrefix(string(s0.Data[certs.CACert])))
+			caCerts, err := parseCertificates(s1.Data[certs.CACert])
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(caCerts).Should(HaveLen(2))
+
+			By("switching to the next CA")
+			time.Sleep(2 * time.Millisecond)
+			_, err = r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			s2 := getSecret(secret.Name)
+			Ω(s2.Data).ShouldNot(HaveKey(certs.CANextKey))
+			Ω(s2.Data[certs.CAKey]).Should(Equal(s1.Data[certs.CANextKey]))
+			Ω(s2.Data[certs.CACert]).Should(Equal(s1.Data[certs.CACert]))
+			Ω(s2.Data[certs.ServerCert]).ShouldNot(Equal(s1.Data[certs.ServerCert]))
+			verify(s2.Data[certs.ServerCert], encodeCertificate(caCerts[1]))
+
+			By("removing the old CA from the bundle")
+			time.Sleep(2 * time.Millisecond)
+			_, err = r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			s3 := getSecret(secret.Name)
+			Ω(s3.Annotations).ShouldNot(HaveKey(certs.CARotationAnnotation))
+			Ω(s3.Data[certs.CACert]).Should(Equal(encodeCertificate(caCerts[1])))
+			Ω(s3.Data[certs.ServerCert]).Should(Equal(s2.Data[certs.ServerCert]))
+		})
+
+		It("should requeue at the start of the CA rotation", func() {
+			r.opts.CAValidity = 3 * time.Hour
+			r.opts.CertValidity = 3 * time.Hour
+			r.opts.UpdateBefore = time.Hour
+			r.opts.CARotationGracePeriod = 20 * time.Minute
+
+			res, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res.RequeueAfter).Should(BeNumerically("~", 80*time.Minute, time.Minute))
+		})
+
+		It("should not re-sign a due server cert while the next CA is published", func() {
+			r.opts.CARotationGracePeriod = time.Hour
+			_, err := r.Reconcile(ctx, ctrl.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			s0 := getSecret(secret.Name)
+			rotations := metrics.Rotations.WithLabelValues(secret.Namespace, secret.Name, metrics.RotationServer)
+			before := testutil.ToFloat64(rotations)
+
+			r.opts.UpdateBefore = 10 * 365 * 24 * time.Hour
+			for range 4 {
+				res, err := r.Reconcile(ctx, ctrl.Request{})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(res.RequeueAfter).Should(BeNumerically(">", 59*time.Minute))
+
+				s := getSecret(secret.Name)
+				Ω(s.Data).Should(HaveKey(certs.CANextKey))
+				Ω(s.Data[certs.ServerCert]).Should(Equal(s0.Data[certs.ServerCert]))
+				Ω(s.Data[certs.ServerKey]).Should(Equal(s0.Data[certs.ServerKey]))
+			}
+			Ω(testutil.ToFloat64(rotations)).Should(Equal(before))
+			Ω(r.NextRenewal()).Should(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+		})
+	})
+})
+
+func verify(serverCertPEM, caCertPEM []byte) {
+	serverCerts, err := parseCertificates(serverCertPEM)
+	Ω(err).ShouldNot(HaveOccurred())
+	pool := x509.NewCertPool()
+	Ω(pool.AppendCertsFromPEM(caCertPEM)).Should(BeTrue())
+	_, err = serverCerts[0].Verify(x509.VerifyOptions{Roots: pool})
+	Ω(err).ShouldNot(HaveOccurred())
+}
@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/bakito/operator-utils/pkg/certs/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// recordRotation counts a renewal of the server certificate or the CA and records an event on the secret
+func (r *reconciler) recordRotation(secret *corev1.Secret, kind string) {
+	metrics.Rotations.WithLabelValues(r.nn.Namespace, r.nn.Name, kind).Inc()
+	if kind == metrics.RotationCA {
+		r.event(secret, corev1.EventTypeNormal, certs.EventReasonCertificateRotated, "CA was renewed")
+	} else {
+		r.event(secret, corev1.EventTypeNormal, certs.EventReasonCertificateRotated, "Server certificate was renewed")
+	}
+}
+
+// event records an event on the object, if an event recorder is configured
+func (r *reconciler) event(obj runtime.Object, eventType, reason, message string) {
+	if r.recorder != nil {
+		r.recorder.Event(obj, eventType, reason, message)
+	}
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bakito/operator-utils/pkg/log"
+	corev1 "k8s.io/api/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// certDirWriter writes the certificates of the cert secret into the cert dir on every replica,
+// as the reconciler only runs on the leader
+type certDirWriter struct {
+	r     *reconciler
+	cache cache.Cache
+}
+
+func (w *certDirWriter) NeedLeaderElection() bool {
+	return false
+}
+
+// Start registers the writer with the secret informer of the cache and waits until the context is done
+func (w *certDirWriter) Start(ctx context.Context) error {
+	informer, err := w.cache.GetInformer(ctx, &corev1.Secret{})
+	if err != nil {
+		return err
+	}
+	if _, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    w.write,
+		UpdateFunc: func(_, obj interface{}) { w.write(obj) },
+	}); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// write writes the certificates of the cert secret into the cert dir
+func (w *certDirWriter) write(obj interface{}) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || secret.Namespace != w.r.nn.Namespace || secret.Name != w.r.nn.Name {
+		return
+	}
+	if err := w.r.writeCertDir(secret); err != nil {
+		log.With(w.r.logger(), secret).Error(err, "could not write the certificates into the cert dir")
+	}
+}
+
+// writeCertDir writes the certificates of the secret into the local cert dir.
+// Only files with changed content are written.
+func (r *reconciler) writeCertDir(secret *corev1.Secret) error {
+	if err := os.MkdirAll(r.opts.CertDir, 0o700); err != nil {
+		return fmt.Errorf("error creating cert dir %q: %w", r.opts.CertDir, err)
+	}
+	// the key is written first, as the server cert is usually the file watched to reload the key pair
+	for _, key := range []string{r.opts.ServerKey, r.opts.ServerCert, r.opts.CACert} {
+		data, ok := secret.Data[key]
+		if !ok {
+			continue
+		}
+		if err := writeFileAtomic(filepath.Join(r.opts.CertDir, key), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes the data into a temporary file and renames it to the target file,
+// so readers never see a partially written file.
+func writeFileAtomic(name string, data []byte) error {
+	if current, err := os.ReadFile(name); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file for %q: %w", name, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing %q: %w", name, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error syncing %q: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing %q: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("error renaming %q: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// SecretChecker returns a checker verifying that the secret holds a valid, unexpired key pair signed by the CA
+func (r *reconciler) SecretChecker() healthz.Checker {
+	return func(req *http.Request) error {
+		secret, err := r.getSecret(req)
+		if err != nil {
+			return err
+		}
+
+		pair, err := tls.X509KeyPair(secret.Data[r.opts.ServerCert], secret.Data[r.opts.ServerKey])
+		if err != nil {
+			return fmt.Errorf("invalid key pair: %w", err)
+		}
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("error parsing certificate: %w", err)
+		}
+		now := time.Now()
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return fmt.Errorf("certificate is only valid from %s to %s",
+				cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		}
+
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(secret.Data[r.opts.CACert]) {
+			return errors.New("error parsing the CA certificate")
+		}
+		if _, err := cert.Verify(x509.VerifyOptions{
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}); err != nil {
+			return fmt.Errorf("certificate is not signed by the CA: %w", err)
+		}
+		return nil
+	}
+}
+
+// CertDirChecker returns a checker verifying that the files in the cert dir match the secret
+func (r *reconciler) CertDirChecker() healthz.Checker {
+	return func(req *http.Request) error {
+		secret, err := r.getSecret(req)
+		if err != nil {
+			return err
+		}
+		for _, key := range []string{r.opts.ServerKey, r.opts.ServerCert, r.opts.CACert} {
+			data, err := os.ReadFile(filepath.Join(r.opts.CertDir, key))
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(data, secret.Data[key]) {
+				return fmt.Errorf("file %q does not match the secret", key)
+			}
+		}
+		return nil
+	}
+}
+
+// InjectionChecker returns a checker verifying that all ca injection targets carry the current ca cert
+func (r *reconciler) InjectionChecker() healthz.Checker {
+	return func(req *http.Request) error {
+		if r.watcher == nil {
+			return errors.New("the ca watcher is not set up")
+		}
+		return r.watcher.Checker()(req)
+	}
+}
+
+func (r *reconciler) getSecret(req *http.Request) (*corev1.Secret, error) {
+	if r.Client == nil {
+		return nil, errors.New("the certs controller is not set up")
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(req.Context(), r.nn, secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
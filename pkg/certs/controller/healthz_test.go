@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Healthz", func() {
+	var (
+		r   *reconciler
+		req *http.Request
+	)
+
+	BeforeEach(func() {
+		var err error
+		req, err = http.NewRequestWithContext(context.TODO(), http.MethodGet, "/readyz", http.NoBody)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "test-ns", Name: "test-name"}}
+		r = New(logr.Discard(), secret.Namespace, secret.Name, certs.Options{
+			WriteCertDir: true,
+			CertDir:      GinkgoT().TempDir(),
+		}, WithClient(fake.NewClientBuilder().WithObjects(secret).Build())).(*reconciler)
+	})
+
+	// reconcile creates the certs and writes them into the cert dir like the cert dir writer
+	reconcile := func() {
+		_, err := r.Reconcile(req.Context(), ctrl.Request{})
+		Ω(err).ShouldNot(HaveOccurred())
+		secret := &corev1.Secret{}
+		Ω(r.Get(req.Context(), r.nn, secret)).ShouldNot(HaveOccurred())
+		Ω(r.writeCertDir(secret)).ShouldNot(HaveOccurred())
+	}
+
+	It("should fail before the certs are created", func() {
+		Ω(r.SecretChecker()(req)).Should(HaveOccurred())
+		Ω(r.CertDirChecker()(req)).Should(HaveOccurred())
+	})
+
+	It("should succeed once the certs are created", func() {
+		reconcile()
+
+		Ω(r.SecretChecker()(req)).ShouldNot(HaveOccurred())
+		Ω(r.CertDirChecker()(req)).ShouldNot(HaveOccurred())
+	})
+
+	It("should fail if the mounted files do not match the secret", func() {
+		reconcile()
+		Ω(os.WriteFile(filepath.Join(r.opts.CertDir, certs.CACert), []byte("other"), 0o600)).ShouldNot(HaveOccurred())
+
+		Ω(r.CertDirChecker()(req)).Should(MatchError(ContainSubstring(certs.CACert)))
+	})
+
+	It("should fail if the watcher is not set up", func() {
+		Ω(r.InjectionChecker()(req)).Should(MatchError(ContainSubstring("not set up")))
+	})
+})
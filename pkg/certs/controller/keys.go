@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+)
+
+// generateKey creates a new private key for the configured algorithm and size
+func (r *reconciler) generateKey() (crypto.Signer, error) {
+	switch r.opts.KeyAlgorithm {
+	case certs.RSA:
+		return rsa.GenerateKey(rand.Reader, r.opts.KeySize)
+	case certs.ECDSA:
+		curve, err := ellipticCurve(r.opts.KeySize)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case certs.Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unsupported key algorithm %q", r.opts.KeyAlgorithm)
+}
+
+// signatureAlgorithm the signature algorithm matching the configured key type
+func (r *reconciler) signatureAlgorithm() x509.SignatureAlgorithm {
+	switch r.opts.KeyAlgorithm {
+	case certs.ECDSA:
+		switch r.opts.KeySize {
+		case 384:
+			return x509.ECDSAWithSHA384
+		case 521:
+			return x509.ECDSAWithSHA512
+		}
+		return x509.ECDSAWithSHA256
+	case certs.Ed25519:
+		return x509.PureEd25519
+	}
+	return x509.SHA256WithRSA
+}
+
+// matchesKeyAlgorithm checks if the public key matches the configured algorithm and size
+func (r *reconciler) matchesKeyAlgorithm(pub crypto.PublicKey) bool {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return r.opts.KeyAlgorithm == certs.RSA && k.N.BitLen() == r.opts.KeySize
+	case *ecdsa.PublicKey:
+		return r.opts.KeyAlgorithm == certs.ECDSA && k.Curve.Params().BitSize == r.opts.KeySize
+	case ed25519.PublicKey:
+		return r.opts.KeyAlgorithm == certs.Ed25519
+	}
+	return false
+}
+
+func ellipticCurve(size int) (elliptic.Curve, error) {
+	switch size {
+	case 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	case 521:
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("unsupported ECDSA key size %d", size)
+}
+
+// encodeKey encodes the private key as PKCS#8 PEM
+func encodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"github.com/bakito/operator-utils/pkg/certs/metrics"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// recordCertMetrics records the NotAfter of the server certificate and of the CA that signed it
+func (r *reconciler) recordCertMetrics(secret *corev1.Secret) {
+	serverCerts, err := parseCertificates(secret.Data[r.opts.ServerCert])
+	if err != nil || len(serverCerts) == 0 {
+		return
+	}
+	metrics.CertNotAfter.WithLabelValues(r.nn.Namespace, r.nn.Name).Set(float64(serverCerts[0].NotAfter.Unix()))
+
+	caCerts, err := parseCertificates(secret.Data[r.opts.CACert])
+	if err != nil {
+		return
+	}
+	for _, ca := range caCerts {
+		if serverCerts[0].CheckSignatureFrom(ca) == nil {
+			metrics.CANotAfter.WithLabelValues(r.nn.Namespace, r.nn.Name).Set(float64(ca.NotAfter.Unix()))
+			return
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"github.com/bakito/operator-utils/pkg/certs/watcher"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const eventSource = "webhook-certs"
+
+// Option configures the reconciler
+type Option func(r *reconciler)
+
+// WithManager takes the client and event recorder from the manager of the cert secret namespace
+func WithManager(mgr ctrl.Manager) Option {
+	return func(r *reconciler) {
+		r.Client = mgr.GetClient()
+		r.recorder = mgr.GetEventRecorderFor(eventSource) //nolint:staticcheck
+	}
+}
+
+// WithClient sets the client used to read and write the cert secret
+func WithClient(c client.Client) Option {
+	return func(r *reconciler) {
+		r.Client = c
+	}
+}
+
+// WithEventRecorder sets the recorder for the events on the cert secret
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(r *reconciler) {
+		r.recorder = recorder
+	}
+}
+
+// WithWatcherOptions passes options to the ca watcher created in SetupWithManager
+func WithWatcherOptions(options ...watcher.Option) Option {
+	return func(r *reconciler) {
+		r.watcherOptions = append(r.watcherOptions, options...)
+	}
+}
@@ -4,17 +4,25 @@ import (
 	"errors"
 
 	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/bakito/operator-utils/pkg/certs/metrics"
 	"github.com/bakito/operator-utils/pkg/certs/watcher"
 	"github.com/bakito/operator-utils/pkg/filter"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
-// New create a new reconciler
-func New(log logr.Logger, namespace string, secretName string, opts certs.Options) Reconciler {
-	return &reconciler{
+// New create a new reconciler. A missing client is taken from the namespaced manager in SetupWithManager.
+func New(log logr.Logger, namespace string, secretName string, opts certs.Options, options ...Option) Reconciler {
+	if opts.Namespace == "" {
+		opts.Namespace = namespace
+	}
+	r := &reconciler{
 		log:  log,
 		opts: opts.ApplyDefaults(secretName),
 		nn: types.NamespacedName{
@@ -22,26 +30,64 @@ func New(log logr.Logger, namespace string, secretName string, opts certs.Option
 			Name:      secretName,
 		},
 	}
+	for _, o := range options {
+		o(r)
+	}
+	return r
 }
 
 func (r *reconciler) SetupWithManager(globalMgr, namespacedMgr ctrl.Manager) error {
 	if r.opts.Name == "" {
 		return errors.New("no name defined")
 	}
+	if err := r.opts.Validate(); err != nil {
+		return err
+	}
 
 	// setup ca cert watcher
-	w := watcher.New(r.opts)
-	if err := globalMgr.Add(w); err != nil {
+	w := watcher.New(r.opts, append([]watcher.Option{watcher.WithManager(globalMgr)}, r.watcherOptions...)...)
+	if err := w.SetupWithManager(globalMgr); err != nil {
+		return err
+	}
+	r.watcher = w
+
+	if r.Client == nil {
+		r.Client = namespacedMgr.GetClient()
+	}
+	if r.recorder == nil {
+		r.recorder = namespacedMgr.GetEventRecorderFor(eventSource) //nolint:staticcheck
+	}
+
+	if err := metrics.RegisterRenewal(r.nn.Namespace, r.nn.Name, r.NextRenewal); err != nil {
 		return err
 	}
 
-	r.Client = namespacedMgr.GetClient()
+	if r.opts.WriteCertDir {
+		if err := namespacedMgr.Add(&certDirWriter{r: r, cache: namespacedMgr.GetCache()}); err != nil {
+			return err
+		}
+	}
+
+	names := []string{r.nn.Name}
+	if r.opts.KeepCA && r.opts.CASecretName != "" {
+		names = append(names, r.opts.CASecretName)
+	}
 
-	return ctrl.NewControllerManagedBy(namespacedMgr).
+	b := ctrl.NewControllerManagedBy(namespacedMgr).
 		For(&corev1.Secret{}).
 		WithEventFilter(filter.NamePredicate{
 			Namespace: r.nn.Namespace,
-			Names:     []string{r.nn.Name},
-		}).
-		Complete(r)
+			Names:     names,
+		})
+
+	if r.opts.CreateSecret {
+		// trigger an initial reconcile, as there is no event if the secret does not exist
+		initial := make(chan event.GenericEvent, 1)
+		initial <- event.GenericEvent{Object: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: r.nn.Namespace, Name: r.nn.Name},
+		}}
+		b = b.WatchesRawSource(source.Channel(initial, &handler.EnqueueRequestForObject{}))
+	}
+
+	return b.Complete(r)
 }
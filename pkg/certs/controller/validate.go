@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// validateCerts validates the certificates of the secret against the options. An error describing the reason
+// is returned if the certificates are invalid or have to be updated.
+func (r *reconciler) validateCerts(secret *corev1.Secret) error {
+	return r.validateCertsBefore(secret, r.opts.UpdateBefore)
+}
+
+// validateCertsBefore validates the certificates of the secret, which must be valid for at least updateBefore
+func (r *reconciler) validateCertsBefore(secret *corev1.Secret, updateBefore time.Duration) error {
+	for _, key := range []string{r.opts.ServerKey, r.opts.ServerCert, r.opts.CACert} {
+		if _, haskey := secret.Data[key]; !haskey {
+			return fmt.Errorf("certificate secret is missing key %q", key)
+		}
+	}
+
+	pair, err := tls.X509KeyPair(secret.Data[r.opts.ServerCert], secret.Data[r.opts.ServerKey])
+	if err != nil {
+		return fmt.Errorf("error creating pem from certificate and key: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("error parsing certificate: %w", err)
+	}
+
+	if !time.Now().Add(updateBefore).Before(cert.NotAfter) {
+		return fmt.Errorf("certificate expires at %s", cert.NotAfter.Format(time.RFC3339))
+	}
+
+	if !r.matchesKeyAlgorithm(cert.PublicKey) {
+		return fmt.Errorf("certificate key does not match the key algorithm %q with size %d",
+			r.opts.KeyAlgorithm, r.opts.KeySize)
+	}
+
+	if cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return errors.New("certificate is missing the key usage digital signature")
+	}
+	if !slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageServerAuth) {
+		return errors.New("certificate is missing the extended key usage server auth")
+	}
+
+	if !sameElements(cert.DNSNames, r.dnsNames()) {
+		return fmt.Errorf("certificate DNS names %v do not match %v", cert.DNSNames, r.dnsNames())
+	}
+	if !sameElements(ipStrings(cert.IPAddresses), ipStrings(r.ipAddresses())) {
+		return fmt.Errorf("certificate IP addresses %v do not match %v", cert.IPAddresses, r.ipAddresses())
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(secret.Data[r.opts.CACert]) {
+		return errors.New("error parsing the CA certificate")
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		DNSName:   r.commonName(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		return fmt.Errorf("certificate is not signed by the CA: %w", err)
+	}
+	return nil
+}
+
+func sameElements(a, b []string) bool {
+	a = slices.Clone(a)
+	b = slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+func ipStrings(ips []net.IP) []string {
+	var result []string
+	for _, ip := range ips {
+		result = append(result, ip.String())
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"github.com/bakito/operator-utils/pkg/certs"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Validate", func() {
+	var (
+		r      *reconciler
+		secret *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		o := certs.Options{}
+		r = &reconciler{
+			nn:   types.NamespacedName{Namespace: "test-ns", Name: "test-name"},
+			opts: o.ApplyDefaults("test-name"),
+		}
+		serverKey, serverCert, caCert, err := r.createCerts()
+		Ω(err).ShouldNot(HaveOccurred())
+		secret = &corev1.Secret{Data: map[string][]byte{
+			certs.ServerKey:  serverKey,
+			certs.ServerCert: serverCert,
+			certs.CACert:     caCert,
+		}}
+	})
+
+	It("should accept valid certs", func() {
+		Ω(r.validateCerts(secret)).ShouldNot(HaveOccurred())
+	})
+
+	It("should reject missing keys", func() {
+		delete(secret.Data, certs.CACert)
+		Ω(r.validateCerts(secret)).Should(MatchError(ContainSubstring(certs.CACert)))
+	})
+
+	It("should reject certs about to expire", func() {
+		r.opts.UpdateBefore = 2 * certs.OneYear
+		Ω(r.validateCerts(secret)).Should(MatchError(ContainSubstring("expires")))
+	})
+
+	It("should reject certs with a different key algorithm", func() {
+		r.opts.KeyAlgorithm = certs.ECDSA
+		r.opts.KeySize = certs.ECDSAKeySize
+		Ω(r.validateCerts(secret)).Should(MatchError(ContainSubstring("key algorithm")))
+	})
+
+	It("should reject certs with a different service name", func() {
+		r.opts.ServiceName = "other"
+		Ω(r.validateCerts(secret)).Should(MatchError(ContainSubstring("DNS names")))
+	})
+
+	It("should reject certs with different IP addresses", func() {
+		r.opts.IPAddresses = []string{"10.0.0.1"}
+		Ω(r.validateCerts(secret)).Should(MatchError(ContainSubstring("IP addresses")))
+	})
+
+	It("should reject certs not signed by the CA", func() {
+		_, _, otherCA, err := r.createCerts()
+		Ω(err).ShouldNot(HaveOccurred())
+		secret.Data[certs.CACert] = otherCA
+		Ω(r.validateCerts(secret)).Should(MatchError(ContainSubstring("not signed by the CA")))
+	})
+})
@@ -0,0 +1,10 @@
+package certs
+
+const (
+	// EventReasonCertificateRotated the server certificate or the CA was renewed
+	EventReasonCertificateRotated = "CertificateRotated"
+	// EventReasonCABundleInjected the ca bundle was injected into a target
+	EventReasonCABundleInjected = "CABundleInjected"
+	// EventReasonCABundleInjectionFailed injecting the ca bundle into a target failed
+	EventReasonCABundleInjectionFailed = "CABundleInjectionFailed"
+)
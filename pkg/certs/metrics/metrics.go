@@ -0,0 +1,105 @@
+// Package metrics provides the prometheus metrics of the webhook certs controller and ca watcher.
+// The metrics are registered with the controller-runtime metrics registry.
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	namespace = "operator_utils"
+	subsystem = "certs"
+
+	// RotationServer the server certificate was renewed
+	RotationServer = "server"
+	// RotationCA the signing CA was renewed
+	RotationCA = "ca"
+
+	// ResultSuccess the ca bundle was patched successfully
+	ResultSuccess = "success"
+	// ResultFailure patching the ca bundle failed
+	ResultFailure = "failure"
+)
+
+var (
+	// CertNotAfter the NotAfter of the current server certificate
+	CertNotAfter = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "server_cert_not_after_timestamp_seconds",
+		Help:      "The NotAfter of the current server certificate as unix timestamp.",
+	}, []string{"namespace", "secret"})
+
+	// CANotAfter the NotAfter of the CA that signed the current server certificate
+	CANotAfter = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "ca_not_after_timestamp_seconds",
+		Help:      "The NotAfter of the CA that signed the current server certificate as unix timestamp.",
+	}, []string{"namespace", "secret"})
+
+	// Rotations the number of certificate renewals
+	Rotations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "rotations_total",
+		Help:      "The number of renewals of the server certificate and the CA.",
+	}, []string{"namespace", "secret", "kind"})
+
+	// CAInjections the number of ca bundle patches per target object and result
+	CAInjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "ca_injections_total",
+		Help:      "The number of ca bundle patches per target object and result.",
+	}, []string{"name", "kind", "object", "result"})
+
+	// CASyncFailures the number of ca bundle syncs that failed after all retries
+	CASyncFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "ca_sync_failures_total",
+		Help:      "The number of ca bundle syncs that failed after all retries.",
+	}, []string{"name"})
+
+	// LastSync the time of the last successful ca bundle sync
+	LastSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "ca_last_sync_timestamp_seconds",
+		Help:      "The time of the last successful ca bundle sync as unix timestamp.",
+	}, []string{"name"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(CertNotAfter, CANotAfter, Rotations, CAInjections, CASyncFailures, LastSync)
+}
+
+// RegisterRenewal registers a gauge reporting the seconds until the next renewal of the server certificate.
+// A gauge registered before for the same secret is replaced.
+func RegisterRenewal(secretNamespace, secretName string, nextRenewal func() time.Time) error {
+	g := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "seconds_until_renewal",
+		Help:        "The seconds until the next renewal of the server certificate.",
+		ConstLabels: prometheus.Labels{"namespace": secretNamespace, "secret": secretName},
+	}, func() float64 {
+		next := nextRenewal()
+		if next.IsZero() {
+			return 0
+		}
+		return time.Until(next).Seconds()
+	})
+
+	metrics.Registry.Unregister(g)
+	err := metrics.Registry.Register(g)
+	if are := (prometheus.AlreadyRegisteredError{}); errors.As(err, &are) {
+		return nil
+	}
+	return err
+}
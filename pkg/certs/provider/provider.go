@@ -0,0 +1,107 @@
+// Package provider serves the webhook server certificate from memory. The certificate is read from the cert
+// secret through an informer, so a renewal takes effect right away without volume mounts.
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// Provider provides the server certificate of the cert secret to the webhook server
+type Provider interface {
+	// SetupWithManager starts an informer on the cert secret with the manager
+	SetupWithManager(mgr ctrl.Manager) error
+	// GetCertificate returns the current server certificate, to be used as tls.Config GetCertificate
+	GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	// TLSOpt sets GetCertificate in the tls config, to be added to the webhook.Options TLSOpts
+	TLSOpt(cfg *tls.Config)
+	// Ready returns an error as long as no valid certificate was loaded, to be used with certs.WaitForCerts
+	Ready() error
+}
+
+// New create a new provider for the cert secret
+func New(log logr.Logger, namespace string, secretName string, opts certs.Options) Provider {
+	return &provider{
+		log:  log,
+		opts: opts.ApplyDefaults(secretName),
+		nn: types.NamespacedName{
+			Namespace: namespace,
+			Name:      secretName,
+		},
+	}
+}
+
+type provider struct {
+	log  logr.Logger
+	nn   types.NamespacedName
+	opts certs.Options
+
+	mux  sync.RWMutex
+	cert *tls.Certificate
+}
+
+func (p *provider) SetupWithManager(mgr ctrl.Manager) error {
+	// the webhook server is started by all replicas, so the cache must not depend on the leader election
+	secret := &corev1.Secret{}
+	c, err := certs.NewObjectCache(mgr, p.nn.Namespace, p.nn.Name, secret)
+	if err != nil {
+		return err
+	}
+
+	informer, err := c.GetInformer(context.Background(), secret, cache.BlockUntilSynced(false))
+	if err != nil {
+		return err
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    p.update,
+		UpdateFunc: func(_, obj interface{}) { p.update(obj) },
+	})
+	return err
+}
+
+// update loads the certificate of the secret. An invalid certificate is ignored and the current one is kept.
+func (p *provider) update(obj interface{}) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || secret.Namespace != p.nn.Namespace || secret.Name != p.nn.Name {
+		return
+	}
+
+	pair, err := tls.X509KeyPair(secret.Data[p.opts.ServerCert], secret.Data[p.opts.ServerKey])
+	if err != nil {
+		p.log.WithValues("certs", p.nn).Info("Secret does not contain a valid certificate", "reason", err.Error())
+		return
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.cert = &pair
+	p.log.WithValues("certs", p.nn).V(1).Info("Loaded the server certificate")
+}
+
+func (p *provider) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	if p.cert == nil {
+		return nil, errors.New("the server certificate is not loaded yet")
+	}
+	return p.cert, nil
+}
+
+func (p *provider) TLSOpt(cfg *tls.Config) {
+	cfg.GetCertificate = p.GetCertificate
+}
+
+func (p *provider) Ready() error {
+	_, err := p.GetCertificate(nil)
+	return err
+}
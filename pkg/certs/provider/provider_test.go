@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/bakito/operator-utils/pkg/certs/certstest"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Provider", func() {
+	var p *provider
+
+	newSecret := func(name, commonName string) *corev1.Secret {
+		cert, key, err := certstest.SelfSigned(commonName, time.Now())
+		Ω(err).ShouldNot(HaveOccurred())
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test-ns", Name: name},
+			Data:       map[string][]byte{certs.ServerCert: cert, certs.ServerKey: key},
+		}
+	}
+	commonName := func() string {
+		cert, err := p.GetCertificate(nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		return cert.Leaf.Subject.CommonName
+	}
+
+	BeforeEach(func() {
+		p = New(logr.Discard(), "test-ns", "test", certs.Options{}).(*provider)
+	})
+
+	It("should not be ready before a certificate is loaded", func() {
+		Ω(p.Ready()).Should(HaveOccurred())
+		_, err := p.GetCertificate(nil)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should serve the certificate of the secret", func() {
+		p.update(newSecret("test", "first"))
+		Ω(p.Ready()).ShouldNot(HaveOccurred())
+		Ω(commonName()).Should(Equal("first"))
+
+		p.update(newSecret("test", "second"))
+		Ω(commonName()).Should(Equal("second"))
+	})
+
+	It("should keep the current certificate if the secret is invalid", func() {
+		p.update(newSecret("test", "first"))
+
+		invalid := newSecret("test", "invalid")
+		invalid.Data[certs.ServerKey] = nil
+		p.update(invalid)
+		Ω(commonName()).Should(Equal("first"))
+	})
+
+	It("should ignore other secrets", func() {
+		p.update(newSecret("other", "other"))
+		Ω(p.Ready()).Should(HaveOccurred())
+	})
+
+	It("should set GetCertificate in the tls config", func() {
+		p.update(newSecret("test", "first"))
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		p.TLSOpt(cfg)
+
+		cert, err := cfg.GetCertificate(nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(cert.Leaf.Subject.CommonName).Should(Equal("first"))
+	})
+})
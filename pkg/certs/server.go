@@ -0,0 +1,68 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// certWaitInterval the interval the readiness of the certs is checked
+const certWaitInterval = time.Second
+
+// Readiness checks if the certs are ready to be served. The returned error describes why they are not.
+type Readiness func() error
+
+// FilesReady checks that the cert dir holds a valid key pair
+func FilesReady(opts Options) Readiness {
+	opts = opts.ApplyDefaults(opts.Name)
+	return func() error {
+		_, err := tls.LoadX509KeyPair(filepath.Join(opts.CertDir, opts.ServerCert), filepath.Join(opts.CertDir, opts.ServerKey))
+		return err
+	}
+}
+
+// WaitForCerts wraps the webhook server, so it is only started once the certs are ready.
+// Without readiness checks, the server waits for a valid key pair in the cert dir.
+// The server fails to start if the certs are not ready within CertWaitTimeout.
+func WaitForCerts(server webhook.Server, opts Options, ready ...Readiness) webhook.Server {
+	opts = opts.ApplyDefaults(opts.Name)
+	if len(ready) == 0 {
+		ready = []Readiness{FilesReady(opts)}
+	}
+	return &waitingServer{Server: server, timeout: opts.CertWaitTimeout, ready: ready}
+}
+
+type waitingServer struct {
+	webhook.Server
+	timeout time.Duration
+	ready   []Readiness
+}
+
+// Start starts the webhook server once the certs are ready
+func (s *waitingServer) Start(ctx context.Context) error {
+	var notReady error
+	err := wait.PollUntilContextTimeout(ctx, certWaitInterval, s.timeout, true, func(context.Context) (bool, error) {
+		for _, ready := range s.ready {
+			if notReady = ready(); notReady != nil {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if ctx.Err() != nil {
+		// the manager is shutting down
+		return nil
+	}
+	if err != nil {
+		if notReady == nil {
+			return fmt.Errorf("webhook certs are not ready: %w", err)
+		}
+		return fmt.Errorf("webhook certs are not ready: %w (%w)", err, notReady)
+	}
+	return s.Server.Start(ctx)
+}
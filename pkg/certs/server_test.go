@@ -0,0 +1,85 @@
+package certs_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/bakito/operator-utils/pkg/certs"
+	"github.com/bakito/operator-utils/pkg/certs/certstest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+type fakeServer struct {
+	webhook.Server
+	started bool
+}
+
+func (s *fakeServer) Start(context.Context) error {
+	s.started = true
+	return nil
+}
+
+var _ = Describe("Server", func() {
+	var (
+		opts   Options
+		server *fakeServer
+	)
+
+	writeCerts := func() {
+		cert, key, err := certstest.SelfSigned("test", time.Now())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(os.WriteFile(filepath.Join(opts.CertDir, ServerCert), cert, 0o600)).ShouldNot(HaveOccurred())
+		Ω(os.WriteFile(filepath.Join(opts.CertDir, ServerKey), key, 0o600)).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		opts = Options{CertDir: GinkgoT().TempDir(), CertWaitTimeout: 3 * time.Second}
+		server = &fakeServer{}
+	})
+
+	It("should start the server once the certs exist", func() {
+		Ω(FilesReady(opts)()).Should(HaveOccurred())
+		time.AfterFunc(100*time.Millisecond, func() {
+			defer GinkgoRecover()
+			writeCerts()
+		})
+
+		Ω(WaitForCerts(server, opts).Start(context.TODO())).ShouldNot(HaveOccurred())
+		Ω(server.started).Should(BeTrue())
+	})
+
+	It("should not fail if the context is done while waiting", func() {
+		ctx, cancel := context.WithCancel(context.TODO())
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		Ω(WaitForCerts(server, opts).Start(ctx)).ShouldNot(HaveOccurred())
+		Ω(server.started).Should(BeFalse())
+	})
+
+	It("should fail if the certs are not ready within the timeout", func() {
+		opts.CertWaitTimeout = 100 * time.Millisecond
+
+		err := WaitForCerts(server, opts).Start(context.TODO())
+		Ω(err).Should(MatchError(ContainSubstring("webhook certs are not ready")))
+		Ω(server.started).Should(BeFalse())
+	})
+
+	It("should use the given readiness checks", func() {
+		ready := false
+		check := func() error {
+			if !ready {
+				ready = true
+				return errors.New("not ready")
+			}
+			return nil
+		}
+
+		Ω(WaitForCerts(server, opts, check).Start(context.TODO())).ShouldNot(HaveOccurred())
+		Ω(server.started).Should(BeTrue())
+	})
+})
@@ -1,6 +1,14 @@
 package certs
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
 
 const (
 	// Dir directory of the certs
@@ -12,10 +20,66 @@ const (
 	// CACert is the name of the key associated with the certificate of the CA for
 	// the keypair.
 	CACert = "ca.crt"
+	// CAKey is the name of the key associated with the private key of the CA.
+	// It is only stored if the CA is kept across certificate rotations.
+	CAKey = "ca.key"
+	// CANextKey is the name of the key associated with the private key of the next CA
+	// while a CA rotation is in progress.
+	CANextKey = "ca-next.key"
+	// CARotationAnnotation annotation holding the start time of the current CA rotation phase.
+	CARotationAnnotation = "operator-utils.bakito.ch/ca-rotation"
 	// OneWeek Time used for updating a certificate before it expires.
 	OneWeek = 7 * 24 * time.Hour
+	// CARotationGracePeriod default time to wait between the phases of a CA rotation.
+	CARotationGracePeriod = 10 * time.Minute
+	// MissingTargetRecheckInterval default interval to re-check missing optional ca injection targets.
+	MissingTargetRecheckInterval = time.Minute
+	// PatchTimeout default timeout of a single attempt to patch the ca injection targets.
+	PatchTimeout = 5 * time.Second
+	// PatchRetries default number of attempts to patch the ca injection targets.
+	PatchRetries = 5
+	// PatchBackoff default initial backoff between the attempts to patch the ca injection targets.
+	PatchBackoff = time.Second
+	// CertWaitTimeout default timeout to wait for the certs before starting the webhook server.
+	CertWaitTimeout = 2 * time.Minute
+	// CAWatchDebounce default window in which ca file events are collapsed into one sync.
+	CAWatchDebounce = 500 * time.Millisecond
+	// OneYear default validity of the server certificate.
+	OneYear = 365 * 24 * time.Hour
+	// FiveYears default validity of the CA certificate.
+	FiveYears = 5 * OneYear
 	// Organization Default cert organisation
 	Organization = "cluster.local"
+	// ClusterDomain default cluster domain
+	ClusterDomain = "cluster.local"
+	// RSAKeySize default key size for RSA keys
+	RSAKeySize = 2048
+	// ECDSAKeySize default key size (curve P-256) for ECDSA keys
+	ECDSAKeySize = 256
+)
+
+// KeyAlgorithm the algorithm used to generate the private keys
+type KeyAlgorithm string
+
+const (
+	// RSA generate RSA keys
+	RSA KeyAlgorithm = "RSA"
+	// ECDSA generate ECDSA keys. KeySize selects the curve (256, 384 or 521)
+	ECDSA KeyAlgorithm = "ECDSA"
+	// Ed25519 generate Ed25519 keys. KeySize is ignored
+	Ed25519 KeyAlgorithm = "Ed25519"
+)
+
+// CASource the source the ca cert is read from by the watcher
+type CASource string
+
+const (
+	// CASourceFile read the ca cert from the file in CertDir (e.g. a mounted secret)
+	CASourceFile CASource = "File"
+	// CASourceSecret read the ca cert from the cert secret
+	CASourceSecret CASource = "Secret"
+	// CASourceConfigMap read the ca cert from a config map (e.g. an OpenShift service-ca bundle)
+	CASourceConfigMap CASource = "ConfigMap"
 )
 
 // Options cert options
@@ -24,11 +88,116 @@ type Options struct {
 	ServerKey                   string
 	ServerCert                  string
 	CACert                      string
+	CAKey                       string
 	UpdateBefore                time.Duration
 	Name                        string
 	MutatingWebhookConfigName   string
 	ValidatingWebhookConfigName string
 	Organization                string
+	KeyAlgorithm                KeyAlgorithm
+	KeySize                     int
+	// KeepCA keeps the CA (incl. its private key) and re-signs the server certificate with the existing CA.
+	// The CA is only recreated once it expires itself.
+	KeepCA bool
+	// CASecretName the name of a separate secret the CA is stored in if KeepCA is enabled.
+	// If empty, the CA is stored in the cert secret.
+	CASecretName string
+	// CARotationGracePeriod the time to wait between the phases of a CA rotation.
+	// First the new CA is added to the CA bundle, after the grace period the server certificate is signed by the new CA
+	// and after another grace period the old CA is removed from the bundle.
+	// The rotation starts UpdateBefore plus two grace periods before the CA expires.
+	CARotationGracePeriod time.Duration
+	// CAValidity the validity of the CA certificate.
+	CAValidity time.Duration
+	// CertValidity the validity of the server certificate.
+	CertValidity time.Duration
+	// ServiceName the name of the webhook service. Defaults to the name of the secret.
+	// An explicit service name must be a DNS-1123 label. A service name defaulted from the secret name
+	// is validated like the secret name as DNS-1123 subdomain, as on earlier versions.
+	ServiceName string
+	// ClusterDomain the domain of the cluster used in the service DNS names.
+	ClusterDomain string
+	// DNSNames additional DNS names of the server certificate.
+	DNSNames []string
+	// IPAddresses additional IP addresses of the server certificate.
+	IPAddresses []string
+	// CreateSecret create the cert secret (and the CA secret) if it does not exist.
+	// The secret is of type kubernetes.io/tls if ServerKey and ServerCert have the default names.
+	CreateSecret bool
+	// SecretLabels labels to be set on created secrets.
+	SecretLabels map[string]string
+	// SecretAnnotations annotations to be set on created secrets.
+	SecretAnnotations map[string]string
+	// SecretOwnerReferences owner references to be set on created secrets.
+	SecretOwnerReferences []metav1.OwnerReference
+	// WriteCertDir write the certificates of the secret directly into CertDir on every replica, as soon as the
+	// secret is updated, without waiting for the kubelet to update the mounted secret volume.
+	// CertDir must be writable (e.g. an emptyDir) and must not be a mounted secret.
+	WriteCertDir bool
+	// ConversionCRDNames names of CRDs whose conversion webhook gets the CA bundle injected.
+	ConversionCRDNames []string
+	// APIServiceNames names of APIServices that get the CA bundle injected.
+	APIServiceNames []string
+	// MutatingWebhookConfigNames additional names of mutating webhook configurations to be updated.
+	MutatingWebhookConfigNames []string
+	// MutatingWebhookConfigSelector selects the mutating webhook configurations to be updated by label.
+	MutatingWebhookConfigSelector *metav1.LabelSelector
+	// ValidatingWebhookConfigNames additional names of validating webhook configurations to be updated.
+	ValidatingWebhookConfigNames []string
+	// ValidatingWebhookConfigSelector selects the validating webhook configurations to be updated by label.
+	ValidatingWebhookConfigSelector *metav1.LabelSelector
+	// WebhookNames if defined, only the webhooks with one of these names are updated.
+	WebhookNames []string
+	// WebhookServiceName if defined, only the webhooks referencing this service are updated.
+	WebhookServiceName string
+	// WebhookServiceNamespace if defined, only the webhooks referencing a service in this namespace are updated.
+	WebhookServiceNamespace string
+	// MutatingWebhookConfigOptional the mutating webhook configurations defined by name may be missing.
+	MutatingWebhookConfigOptional bool
+	// ValidatingWebhookConfigOptional the validating webhook configurations defined by name may be missing.
+	ValidatingWebhookConfigOptional bool
+	// ConversionCRDsOptional the CRDs defined in ConversionCRDNames may be missing.
+	ConversionCRDsOptional bool
+	// APIServicesOptional the APIServices defined in APIServiceNames may be missing.
+	APIServicesOptional bool
+	// MutatingWebhookConfigOptionalNames names of mutating webhook configurations that may be missing,
+	// while the other configurations are required.
+	MutatingWebhookConfigOptionalNames []string
+	// ValidatingWebhookConfigOptionalNames names of validating webhook configurations that may be missing,
+	// while the other configurations are required.
+	ValidatingWebhookConfigOptionalNames []string
+	// ConversionCRDOptionalNames names of the ConversionCRDNames that may be missing, while the other CRDs are required.
+	ConversionCRDOptionalNames []string
+	// APIServiceOptionalNames names of the APIServiceNames that may be missing,
+	// while the other APIServices are required.
+	APIServiceOptionalNames []string
+	// MissingTargetRecheckInterval the interval missing optional targets are re-checked.
+	MissingTargetRecheckInterval time.Duration
+	// PatchTimeout the timeout of a single attempt to patch the ca injection targets.
+	PatchTimeout time.Duration
+	// PatchRetries the number of attempts to patch the ca injection targets.
+	PatchRetries int
+	// PatchBackoff the initial backoff between the attempts to patch the ca injection targets.
+	// The backoff is doubled after each failed attempt.
+	PatchBackoff time.Duration
+	// WatcherLeaderElection inject the ca cert only by the leader. Without leader election every replica injects
+	// its ca cert, but only if it is newer than the current ca bundle of the target.
+	WatcherLeaderElection bool
+	// LegacyWebhookV1beta1 inject the ca cert into admissionregistration.k8s.io/v1beta1 webhook configurations
+	// instead of v1. The v1beta1 api was removed in Kubernetes 1.22.
+	LegacyWebhookV1beta1 bool
+	// CertWaitTimeout the timeout to wait for the certs before starting the webhook server.
+	CertWaitTimeout time.Duration
+	// CAWatchDebounce the window in which ca file events are collapsed into one sync. A negative value disables debouncing.
+	CAWatchDebounce time.Duration
+	// Namespace the namespace of the cert secret.
+	Namespace string
+	// CASource the source the ca cert is read from by the watcher.
+	CASource CASource
+	// CAConfigMapName the name of the config map the ca cert is read from if CASource is ConfigMap.
+	CAConfigMapName string
+	// CAConfigMapKey the key of the ca cert in the config map. Defaults to CACert.
+	CAConfigMapKey string
 }
 
 // ApplyDefaults apply default options
@@ -46,17 +215,160 @@ func (o *Options) ApplyDefaults(name string) Options {
 	if o.CACert == "" {
 		o.CACert = CACert
 	}
+	if o.CAKey == "" {
+		o.CAKey = CAKey
+	}
 	if o.UpdateBefore == 0 {
 		o.UpdateBefore = OneWeek
 	}
+	if o.CARotationGracePeriod == 0 {
+		o.CARotationGracePeriod = CARotationGracePeriod
+	}
+	if o.MissingTargetRecheckInterval == 0 {
+		o.MissingTargetRecheckInterval = MissingTargetRecheckInterval
+	}
+	if o.PatchTimeout == 0 {
+		o.PatchTimeout = PatchTimeout
+	}
+	if o.PatchRetries == 0 {
+		o.PatchRetries = PatchRetries
+	}
+	if o.PatchBackoff == 0 {
+		o.PatchBackoff = PatchBackoff
+	}
+	if o.CertWaitTimeout == 0 {
+		o.CertWaitTimeout = CertWaitTimeout
+	}
+	if o.CAWatchDebounce == 0 {
+		o.CAWatchDebounce = CAWatchDebounce
+	}
+	if o.CASource == "" {
+		o.CASource = CASourceFile
+	}
+	if o.CAConfigMapKey == "" {
+		o.CAConfigMapKey = o.CACert
+	}
+	if o.CAValidity == 0 {
+		o.CAValidity = FiveYears
+	}
+	if o.CertValidity == 0 {
+		o.CertValidity = OneYear
+	}
+	if o.ServiceName == "" {
+		o.ServiceName = o.Name
+	}
+	if o.ClusterDomain == "" {
+		o.ClusterDomain = ClusterDomain
+	}
 	if o.Organization == "" {
 		o.Organization = Organization
 	}
-	if o.MutatingWebhookConfigName == "" {
+	if o.KeyAlgorithm == "" {
+		o.KeyAlgorithm = RSA
+	}
+	if o.KeySize == 0 {
+		switch o.KeyAlgorithm {
+		case RSA:
+			o.KeySize = RSAKeySize
+		case ECDSA:
+			o.KeySize = ECDSAKeySize
+		}
+	}
+	// the configuration names default to the name, if the configurations are not selected otherwise
+	if o.MutatingWebhookConfigName == "" && len(o.MutatingWebhookConfigNames) == 0 &&
+		o.MutatingWebhookConfigSelector == nil {
 		o.MutatingWebhookConfigName = o.Name
 	}
-	if o.ValidatingWebhookConfigName == "" {
+	if o.ValidatingWebhookConfigName == "" && len(o.ValidatingWebhookConfigNames) == 0 &&
+		o.ValidatingWebhookConfigSelector == nil {
 		o.ValidatingWebhookConfigName = o.Name
 	}
 	return *o
 }
+
+// Validate validates the options. Defaults should be applied before.
+func (o *Options) Validate() error {
+	var errs []error
+	if o.UpdateBefore <= 0 {
+		errs = append(errs, errors.New("UpdateBefore must be positive"))
+	}
+	if o.CertValidity <= o.UpdateBefore {
+		errs = append(errs, fmt.Errorf("UpdateBefore (%v) must be shorter than CertValidity (%v)",
+			o.UpdateBefore, o.CertValidity))
+	}
+	if o.CAValidity <= o.UpdateBefore {
+		errs = append(errs, fmt.Errorf("UpdateBefore (%v) must be shorter than CAValidity (%v)",
+			o.UpdateBefore, o.CAValidity))
+	}
+	if o.KeepCA && o.CAValidity < o.CertValidity {
+		errs = append(errs, fmt.Errorf("CAValidity (%v) must not be shorter than CertValidity (%v) if KeepCA is enabled",
+			o.CAValidity, o.CertValidity))
+	}
+	if o.CARotationGracePeriod < 0 {
+		errs = append(errs, errors.New("CARotationGracePeriod must not be negative"))
+	}
+	if o.KeepCA && o.CAValidity <= o.UpdateBefore+2*o.CARotationGracePeriod {
+		errs = append(errs, fmt.Errorf(
+			"UpdateBefore (%v) plus two CARotationGracePeriods (%v) must be shorter than CAValidity (%v) if KeepCA is enabled",
+			o.UpdateBefore, o.CARotationGracePeriod, o.CAValidity))
+	}
+
+	if o.PatchTimeout < 0 || o.PatchRetries < 0 || o.PatchBackoff < 0 {
+		errs = append(errs, errors.New("PatchTimeout, PatchRetries and PatchBackoff must not be negative"))
+	}
+
+	switch o.CASource {
+	case CASourceFile:
+	case CASourceSecret, CASourceConfigMap:
+		if o.Namespace == "" {
+			errs = append(errs, fmt.Errorf("Namespace must be defined for CASource %q", o.CASource))
+		}
+		if o.CASource == CASourceConfigMap && o.CAConfigMapName == "" {
+			errs = append(errs, errors.New("CAConfigMapName must be defined for CASource ConfigMap"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported CASource %q", o.CASource))
+	}
+
+	switch o.KeyAlgorithm {
+	case RSA:
+		if o.KeySize < RSAKeySize {
+			errs = append(errs, fmt.Errorf("RSA KeySize must be at least %d", RSAKeySize))
+		}
+	case ECDSA:
+		if o.KeySize != 256 && o.KeySize != 384 && o.KeySize != 521 {
+			errs = append(errs, fmt.Errorf("unsupported ECDSA KeySize %d", o.KeySize))
+		}
+	case Ed25519:
+	default:
+		errs = append(errs, fmt.Errorf("unsupported KeyAlgorithm %q", o.KeyAlgorithm))
+	}
+
+	// a service name defaulted from the secret name may contain dots like the secret name
+	validateServiceName := validation.IsDNS1123Label
+	if o.ServiceName == o.Name {
+		validateServiceName = validation.IsDNS1123Subdomain
+	}
+	for _, msg := range validateServiceName(o.ServiceName) {
+		errs = append(errs, fmt.Errorf("invalid ServiceName %q: %s", o.ServiceName, msg))
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(o.ClusterDomain) {
+		errs = append(errs, fmt.Errorf("invalid ClusterDomain %q: %s", o.ClusterDomain, msg))
+	}
+	for _, name := range o.DNSNames {
+		if len(validation.IsDNS1123Subdomain(name)) > 0 && len(validation.IsWildcardDNS1123Subdomain(name)) > 0 {
+			errs = append(errs, fmt.Errorf("invalid DNS name %q", name))
+		}
+	}
+	for _, selector := range []*metav1.LabelSelector{o.MutatingWebhookConfigSelector, o.ValidatingWebhookConfigSelector} {
+		if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+			errs = append(errs, fmt.Errorf("invalid webhook config selector: %w", err))
+		}
+	}
+	for _, ip := range o.IPAddresses {
+		if net.ParseIP(ip) == nil {
+			errs = append(errs, fmt.Errorf("invalid IP address %q", ip))
+		}
+	}
+	return errors.Join(errs...)
+}
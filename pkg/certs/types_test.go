@@ -6,6 +6,7 @@ import (
 	. "github.com/bakito/operator-utils/pkg/certs"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var _ = Describe("Types", func() {
@@ -27,8 +28,24 @@ var _ = Describe("Types", func() {
 			Ω(oo.ServerKey).To(Equal(ServerKey))
 			Ω(oo.ServerCert).To(Equal(ServerCert))
 			Ω(oo.CACert).To(Equal(CACert))
+			Ω(oo.CAKey).To(Equal(CAKey))
 			Ω(oo.UpdateBefore).To(Equal(OneWeek))
+			Ω(oo.CARotationGracePeriod).To(Equal(CARotationGracePeriod))
+			Ω(oo.CAValidity).To(Equal(FiveYears))
+			Ω(oo.MissingTargetRecheckInterval).To(Equal(MissingTargetRecheckInterval))
+			Ω(oo.PatchTimeout).To(Equal(PatchTimeout))
+			Ω(oo.PatchRetries).To(Equal(PatchRetries))
+			Ω(oo.PatchBackoff).To(Equal(PatchBackoff))
+			Ω(oo.CAWatchDebounce).To(Equal(CAWatchDebounce))
+			Ω(oo.CertWaitTimeout).To(Equal(CertWaitTimeout))
+			Ω(oo.CASource).To(Equal(CASourceFile))
+			Ω(oo.CAConfigMapKey).To(Equal(CACert))
+			Ω(oo.CertValidity).To(Equal(OneYear))
+			Ω(oo.ServiceName).To(Equal(name))
+			Ω(oo.ClusterDomain).To(Equal(ClusterDomain))
 			Ω(oo.Organization).To(Equal(Organization))
+			Ω(oo.KeyAlgorithm).To(Equal(RSA))
+			Ω(oo.KeySize).To(Equal(RSAKeySize))
 
 			Ω(oo.Name).To(Equal(name))
 			Ω(oo.MutatingWebhookConfigName).To(Equal(name))
@@ -40,23 +57,152 @@ var _ = Describe("Types", func() {
 			o.ServerKey = "ServerKey"
 			o.ServerCert = "ServerCert"
 			o.CACert = "CACert"
+			o.CAKey = "CAKey"
 			o.UpdateBefore = 1 * time.Hour
+			o.CARotationGracePeriod = 1 * time.Minute
+			o.CAValidity = 10 * time.Hour
+			o.MissingTargetRecheckInterval = 2 * time.Minute
+			o.PatchTimeout = 3 * time.Second
+			o.PatchRetries = 7
+			o.PatchBackoff = 2 * time.Second
+			o.CAWatchDebounce = time.Second
+			o.CertWaitTimeout = time.Minute
+			o.CASource = CASourceConfigMap
+			o.CAConfigMapKey = "CAConfigMapKey"
+			o.CertValidity = 5 * time.Hour
+			o.ServiceName = "ServiceName"
+			o.ClusterDomain = "ClusterDomain"
 			o.Name = "old-name"
 			o.MutatingWebhookConfigName = "MutatingWebhookConfigName"
 			o.ValidatingWebhookConfigName = "ValidatingWebhookConfigName"
 			o.Organization = "Organization"
+			o.KeyAlgorithm = ECDSA
+			o.KeySize = 384
 			oo := o.ApplyDefaults(name)
 
 			Ω(oo.CertDir).To(Equal("CertDir"))
 			Ω(oo.ServerKey).To(Equal("ServerKey"))
 			Ω(oo.ServerCert).To(Equal("ServerCert"))
 			Ω(oo.CACert).To(Equal("CACert"))
+			Ω(oo.CAKey).To(Equal("CAKey"))
 			Ω(oo.UpdateBefore).To(Equal(1 * time.Hour))
+			Ω(oo.CARotationGracePeriod).To(Equal(1 * time.Minute))
+			Ω(oo.CAValidity).To(Equal(10 * time.Hour))
+			Ω(oo.MissingTargetRecheckInterval).To(Equal(2 * time.Minute))
+			Ω(oo.PatchTimeout).To(Equal(3 * time.Second))
+			Ω(oo.PatchRetries).To(Equal(7))
+			Ω(oo.PatchBackoff).To(Equal(2 * time.Second))
+			Ω(oo.CAWatchDebounce).To(Equal(time.Second))
+			Ω(oo.CertWaitTimeout).To(Equal(time.Minute))
+			Ω(oo.CASource).To(Equal(CASourceConfigMap))
+			Ω(oo.CAConfigMapKey).To(Equal("CAConfigMapKey"))
+			Ω(oo.CertValidity).To(Equal(5 * time.Hour))
+			Ω(oo.ServiceName).To(Equal("ServiceName"))
+			Ω(oo.ClusterDomain).To(Equal("ClusterDomain"))
 			Ω(oo.Organization).To(Equal("Organization"))
+			Ω(oo.KeyAlgorithm).To(Equal(ECDSA))
+			Ω(oo.KeySize).To(Equal(384))
 
 			Ω(oo.Name).To(Equal(name))
 			Ω(oo.MutatingWebhookConfigName).To(Equal("MutatingWebhookConfigName"))
 			Ω(oo.ValidatingWebhookConfigName).To(Equal("ValidatingWebhookConfigName"))
 		})
+
+		It("webhook config names are not defaulted if selected otherwise", func() {
+			o.MutatingWebhookConfigNames = []string{"a", "b"}
+			o.ValidatingWebhookConfigSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}}
+			oo := o.ApplyDefaults(name)
+
+			Ω(oo.MutatingWebhookConfigName).To(BeEmpty())
+			Ω(oo.ValidatingWebhookConfigName).To(BeEmpty())
+		})
+
+		It("default key size depends on the algorithm", func() {
+			o.KeyAlgorithm = ECDSA
+			Ω(o.ApplyDefaults(name).KeySize).To(Equal(ECDSAKeySize))
+
+			o = &Options{KeyAlgorithm: Ed25519}
+			Ω(o.ApplyDefaults(name).KeySize).To(Equal(0))
+		})
+	})
+
+	Context("Validate", func() {
+		var o *Options
+		BeforeEach(func() {
+			o = &Options{}
+			o.ApplyDefaults("test-name")
+		})
+
+		It("should accept the defaults", func() {
+			Ω(o.Validate()).ShouldNot(HaveOccurred())
+		})
+
+		It("should accept valid SANs", func() {
+			o.DNSNames = []string{"webhook.example.com", "*.example.com"}
+			o.IPAddresses = []string{"10.0.0.1", "::1"}
+			Ω(o.Validate()).ShouldNot(HaveOccurred())
+		})
+
+		It("should reject an UpdateBefore not shorter than the cert validity", func() {
+			o.CertValidity = OneWeek
+			Ω(o.Validate()).Should(MatchError(ContainSubstring("CertValidity")))
+		})
+
+		It("should reject a CA validity shorter than the cert validity if the CA is kept", func() {
+			o.KeepCA = true
+			o.CAValidity = 30 * 24 * time.Hour
+			Ω(o.Validate()).Should(MatchError(ContainSubstring("CAValidity")))
+		})
+
+		It("should reject a CA rotation not completed before the CA has to be updated", func() {
+			o.KeepCA = true
+			o.CARotationGracePeriod = 3 * OneYear
+			Ω(o.Validate()).Should(MatchError(ContainSubstring("CARotationGracePeriod")))
+		})
+
+		It("should reject invalid names", func() {
+			o.ServiceName = "Invalid_Name"
+			o.ClusterDomain = "-invalid"
+			o.DNSNames = []string{"in valid"}
+			o.IPAddresses = []string{"10.0.0.300"}
+			err := o.Validate()
+			Ω(err).Should(MatchError(ContainSubstring("ServiceName")))
+			Ω(err).Should(MatchError(ContainSubstring("ClusterDomain")))
+			Ω(err).Should(MatchError(ContainSubstring("DNS name")))
+			Ω(err).Should(MatchError(ContainSubstring("IP address")))
+		})
+
+		It("should accept a service name defaulted from a dotted secret name", func() {
+			o = &Options{}
+			o.ApplyDefaults("webhook.certs")
+			Ω(o.Validate()).ShouldNot(HaveOccurred())
+
+			o.ServiceName = "webhook.service"
+			Ω(o.Validate()).Should(MatchError(ContainSubstring("ServiceName")))
+		})
+
+		It("should reject invalid selectors", func() {
+			o.MutatingWebhookConfigSelector = &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "foo", Operator: "invalid"}},
+			}
+			Ω(o.Validate()).Should(MatchError(ContainSubstring("selector")))
+		})
+
+		It("should require the namespace and config map name for a config map ca source", func() {
+			o.CASource = CASourceConfigMap
+			err := o.Validate()
+			Ω(err).Should(MatchError(ContainSubstring("Namespace")))
+			Ω(err).Should(MatchError(ContainSubstring("CAConfigMapName")))
+
+			o.Namespace = "test-ns"
+			o.CAConfigMapName = "service-ca"
+			Ω(o.Validate()).ShouldNot(HaveOccurred())
+		})
+
+		It("should reject unsupported keys", func() {
+			o.KeyAlgorithm = ECDSA
+			o.KeySize = 123
+			Ω(o.Validate()).Should(MatchError(ContainSubstring("ECDSA")))
+		})
 	})
 })
@@ -0,0 +1,32 @@
+package watcher
+
+import (
+	"github.com/bakito/operator-utils/pkg/certs"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var apiServiceGVK = schema.GroupVersionKind{
+	Group:   "apiregistration.k8s.io",
+	Version: "v1",
+	Kind:    "APIService",
+}
+
+// APIServiceTarget injects the ca cert into the APIServices listed in APIServiceNames
+func APIServiceTarget(opts certs.Options) Target {
+	return &namedTarget{
+		gvk:      apiServiceGVK,
+		names:    opts.APIServiceNames,
+		optional: optionalNames{all: opts.APIServicesOptional, names: opts.APIServiceOptionalNames},
+		caBundle: []string{"spec", "caBundle"},
+		skip: func(as *unstructured.Unstructured) string {
+			if _, ok, _ := unstructured.NestedMap(as.Object, "spec", "service"); !ok {
+				return "APIService has no service"
+			}
+			if skip, _, _ := unstructured.NestedBool(as.Object, "spec", "insecureSkipTLSVerify"); skip {
+				return "APIService skips TLS verification"
+			}
+			return ""
+		},
+	}
+}
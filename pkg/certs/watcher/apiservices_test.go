@@ -0,0 +1,66 @@
+package watcher
+
+import (
+	"context"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("APIServices", func() {
+	var (
+		t   Target
+		c   client.Client
+		ctx context.Context
+		as  *unstructured.Unstructured
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		as = &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "v1.example.com"},
+			"spec": map[string]interface{}{
+				"group":   "example.com",
+				"version": "v1",
+				"service": map[string]interface{}{"name": "test", "namespace": "test-ns"},
+			},
+		}}
+		as.SetGroupVersionKind(apiServiceGVK)
+		t = APIServiceTarget(certs.Options{APIServiceNames: []string{as.GetName()}})
+		c = fake.NewClientBuilder().WithObjects(as).Build()
+	})
+
+	getCABundle := func() string {
+		a := &unstructured.Unstructured{}
+		a.SetGroupVersionKind(apiServiceGVK)
+		Ω(c.Get(ctx, types.NamespacedName{Name: as.GetName()}, a)).ShouldNot(HaveOccurred())
+		caBundle, _, _ := unstructured.NestedString(a.Object, "spec", "caBundle")
+		return caBundle
+	}
+
+	It("should inject the ca bundle", func() {
+		Ω(t.Inject(ctx, c, []byte("ca"))).Should(BeFalse())
+		Ω(getCABundle()).Should(Equal("Y2E="))
+	})
+
+	It("should check the ca bundle", func() {
+		Ω(t.Check(ctx, c, []byte("ca"))).Should(MatchError(ContainSubstring(`APIService "v1.example.com"`)))
+		Ω(getCABundle()).Should(BeEmpty())
+
+		Ω(t.Inject(ctx, c, []byte("ca"))).Should(BeFalse())
+		Ω(t.Check(ctx, c, []byte("ca"))).ShouldNot(HaveOccurred())
+	})
+
+	It("should not inject the ca bundle into a local APIService", func() {
+		unstructured.RemoveNestedField(as.Object, "spec", "service")
+		Ω(c.Update(ctx, as)).ShouldNot(HaveOccurred())
+
+		Ω(t.Inject(ctx, c, []byte("ca"))).Should(BeFalse())
+		Ω(getCABundle()).Should(BeEmpty())
+	})
+})
@@ -2,22 +2,63 @@ package watcher
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/bakito/operator-utils/pkg/certs/metrics"
 	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 func (w *watcher) watchCA() {
+	recheck := time.NewTicker(w.opts.MissingTargetRecheckInterval)
+	defer recheck.Stop()
+
+	// bursts of events (e.g. a kubelet volume update) are collapsed into one sync
+	var debounce *time.Timer
+	var debounced <-chan time.Time
+	defer func() {
+		if debounce != nil {
+			debounce.Stop()
+		}
+	}()
+
 	for {
 		select {
+		case <-debounced:
+			debounced = nil
+			_ = w.syncChanged()
+
+		case <-recheck.C:
+			if w.missing.Load() {
+				w.logger.V(1).Info("Re-checking missing ca injection targets")
+				_ = w.syncHooks()
+			}
+
 		case event, ok := <-w.caWatcher.Events:
 			// Channel is closed.
 			if !ok {
 				return
 			}
 
-			_ = w.handleEvent(&event)
+			if !w.isCAEvent(&event) {
+				continue
+			}
+			if w.opts.CAWatchDebounce <= 0 {
+				_ = w.syncChanged()
+				continue
+			}
+			if debounce == nil {
+				debounce = time.NewTimer(w.opts.CAWatchDebounce)
+			} else {
+				debounce.Reset(w.opts.CAWatchDebounce)
+			}
+			debounced = debounce.C
 
 		case err, ok := <-w.caWatcher.Errors:
 			// Channel is closed.
@@ -30,38 +71,176 @@ func (w *watcher) watchCA() {
 	}
 }
 
+// recheckMissing periodically re-checks missing optional targets until the context is done
+func (w *watcher) recheckMissing(ctx context.Context) {
+	recheck := time.NewTicker(w.opts.MissingTargetRecheckInterval)
+	defer recheck.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-recheck.C:
+			if w.missing.Load() {
+				w.logger.V(1).Info("Re-checking missing ca injection targets")
+				_ = w.syncHooks()
+			}
+		}
+	}
+}
+
+// dataDir the symlink the kubelet atomically swaps when updating a secret volume
+const dataDir = "..data"
+
 func (w *watcher) handleEvent(event *fsnotify.Event) error {
-	// Only care about events which may modify the contents of the file.
-	if !isWrite(event) && !isRemove(event) && !isCreate(event) {
+	if !w.isCAEvent(event) {
 		return nil
 	}
+	return w.syncChanged()
+}
 
-	w.logger.V(1).Info("webhook ca certificate event", "event", event)
+// isCAEvent checks if the event may have modified the ca cert
+func (w *watcher) isCAEvent(event *fsnotify.Event) bool {
+	// Only care about events which may modify the contents of the file.
+	if !isWrite(event) && !isRemove(event) && !isCreate(event) && !isRename(event) {
+		return false
+	}
 
-	// If the file was removed, re-add the watch.
-	if isRemove(event) {
-		if err := w.caWatcher.Add(w.certFile); err != nil {
-			w.logger.Error(err, "error re-watching file")
-			return err
-		}
+	// the directory is watched, ignore events of unrelated files
+	targetChanged := w.targetChanged()
+	if event.Name != w.certFile && filepath.Base(event.Name) != dataDir && !targetChanged {
+		return false
 	}
 
-	return w.syncHooks()
+	w.logger.V(1).Info("webhook ca certificate event", "event", event, "target", w.certTarget)
+	return true
 }
 
+// targetChanged checks if the resolved path of the cert file changed since the last check
+func (w *watcher) targetChanged() bool {
+	target, err := filepath.EvalSymlinks(w.certFile)
+	if err != nil {
+		// the file is currently being replaced
+		return false
+	}
+	changed := target != w.certTarget
+	w.certTarget = target
+	return changed
+}
+
+// syncHooks patches the current ca cert into all targets
 func (w *watcher) syncHooks() error {
-	dat, err := os.ReadFile(w.certFile)
+	return w.sync(false)
+}
+
+// syncChanged patches the current ca cert into all targets, if it changed since the last successful sync
+func (w *watcher) syncChanged() error {
+	return w.sync(true)
+}
+
+func (w *watcher) sync(onlyChanged bool) error {
+	w.syncMux.Lock()
+	defer w.syncMux.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.opts.PatchTimeout)
+	dat, err := w.readCA(ctx)
+	cancel()
+	if errors.Is(err, os.ErrNotExist) {
+		// the ca cert is synced once it is created
+		w.logger.Info("Webhook ca cert does not exist yet", "file", w.certFile)
+		w.setLastError(err)
+		return nil
+	}
 	if err != nil {
 		w.logger.Error(err, "Error reading webhook ca cert")
+		w.setLastError(err)
+		return err
+	}
+	if len(dat) == 0 {
+		w.logger.Info("Webhook ca cert is empty")
+		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(5)*time.Second)
+	hash := sha256.Sum256(dat)
+	if onlyChanged && w.syncedHash() == hash {
+		w.logger.V(1).Info("Webhook ca cert is unchanged")
+		return nil
+	}
+
+	// retry patching with an exponential backoff, to not keep a stale ca bundle after transient errors
+	backoff := wait.Backoff{
+		Duration: w.opts.PatchBackoff,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    w.opts.PatchRetries,
+	}
+	attempt := 0
+	_ = wait.ExponentialBackoff(backoff, func() (bool, error) {
+		attempt++
+		err = w.patchTargets(dat)
+		if err != nil {
+			w.logger.Error(err, "Error patching ca cert", "attempt", attempt, "attempts", w.opts.PatchRetries)
+			return false, nil
+		}
+		return true, nil
+	})
+
+	w.setLastError(err)
+	if err != nil {
+		metrics.CASyncFailures.WithLabelValues(w.opts.Name).Inc()
+		return err
+	}
+	w.setSyncedHash(hash)
+	metrics.LastSync.WithLabelValues(w.opts.Name).SetToCurrentTime()
+	return nil
+}
+
+// patchTargets patches the ca cert into all targets
+func (w *watcher) patchTargets(caCert []byte) error {
+	ctx, cancel := context.WithTimeout(logr.NewContext(context.Background(), w.logger), w.opts.PatchTimeout)
 	defer cancel()
-	if err = w.patch(ctx, dat); err != nil {
-		w.logger.Error(err, "Error patching webhook ca cert")
+	ctx = withInjection(ctx, w.opts.Name, w.recorder)
+	if !w.NeedLeaderElection() {
+		// every replica injects its ca cert, the newest one must win
+		ctx = withOnlyNewer(ctx)
 	}
+	anyMissing := false
+	defer func() { w.missing.Store(anyMissing) }()
+
+	for _, t := range w.targets {
+		kind := t.Object().GetObjectKind().GroupVersionKind().Kind
+		missing, err := t.Inject(ctx, w.client, caCert)
+		anyMissing = anyMissing || missing
+		if err != nil {
+			return fmt.Errorf("error patching %s ca cert: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+func (w *watcher) setLastError(err error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.lastError = err
+}
+
+func (w *watcher) syncedHash() [sha256.Size]byte {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.caHash
+}
 
-	return err
+func (w *watcher) setSyncedHash(hash [sha256.Size]byte) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.caHash = hash
+}
+
+// LastError returns the error of the last sync, nil if the last sync was successful
+func (w *watcher) LastError() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.lastError
 }
 
 func isWrite(event *fsnotify.Event) bool {
@@ -72,6 +251,10 @@ func isCreate(event *fsnotify.Event) bool {
 	return event != nil && event.Op&fsnotify.Create == fsnotify.Create
 }
 
+func isRename(event *fsnotify.Event) bool {
+	return event != nil && event.Op&fsnotify.Rename == fsnotify.Rename
+}
+
 func isRemove(event *fsnotify.Event) bool {
 	return event != nil && event.Op&fsnotify.Remove == fsnotify.Remove
 }
@@ -0,0 +1,122 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	arv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("CA", func() {
+	var (
+		w       *watcher
+		ctx     context.Context
+		dir     string
+		mwc     *arv1.MutatingWebhookConfiguration
+		patches atomic.Int32
+	)
+
+	// swap updates the ca cert the way the kubelet updates secret volumes
+	swap := func(version, ca string) {
+		data := filepath.Join(dir, "..2026_"+version)
+		Ω(os.Mkdir(data, 0o700)).ShouldNot(HaveOccurred())
+		Ω(os.WriteFile(filepath.Join(data, certs.CACert), []byte(ca), 0o600)).ShouldNot(HaveOccurred())
+		Ω(os.Symlink(filepath.Base(data), filepath.Join(dir, "..data_tmp"))).ShouldNot(HaveOccurred())
+		Ω(os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, dataDir))).ShouldNot(HaveOccurred())
+	}
+	caBundle := func() string {
+		c := &arv1.MutatingWebhookConfiguration{}
+		Ω(w.client.Get(ctx, types.NamespacedName{Name: mwc.Name}, c)).ShouldNot(HaveOccurred())
+		return string(c.Webhooks[0].ClientConfig.CABundle)
+	}
+	setCABundle := func(ca string) {
+		c := &arv1.MutatingWebhookConfiguration{}
+		Ω(w.client.Get(ctx, types.NamespacedName{Name: mwc.Name}, c)).ShouldNot(HaveOccurred())
+		c.Webhooks[0].ClientConfig.CABundle = []byte(ca)
+		Ω(w.client.Update(ctx, c)).ShouldNot(HaveOccurred())
+	}
+	dataEvent := func() *fsnotify.Event {
+		return &fsnotify.Event{Name: filepath.Join(dir, dataDir), Op: fsnotify.Create}
+	}
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		dir = GinkgoT().TempDir()
+		mwc = &arv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Webhooks:   []arv1.MutatingWebhook{{Name: "a.example.com"}},
+		}
+		o := certs.Options{
+			CertDir:                         dir,
+			ValidatingWebhookConfigOptional: true,
+		}
+		patches.Store(0)
+		c := fake.NewClientBuilder().WithObjects(mwc).WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(
+				ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption,
+			) error {
+				patches.Add(1)
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+		w = New(o.ApplyDefaults("test"), WithClient(c), WithLogger(logr.Discard())).(*watcher)
+
+		swap("01", "ca-1")
+		Ω(os.Symlink(filepath.Join(dataDir, certs.CACert), w.certFile)).ShouldNot(HaveOccurred())
+		w.targetChanged()
+		Ω(w.syncHooks()).ShouldNot(HaveOccurred())
+		Ω(caBundle()).Should(Equal("ca-1"))
+		patches.Store(0)
+	})
+
+	It("should patch the ca cert after a symlink swap", func() {
+		swap("02", "ca-2")
+
+		Ω(w.handleEvent(dataEvent())).ShouldNot(HaveOccurred())
+		Ω(caBundle()).Should(Equal("ca-2"))
+	})
+
+	It("should not patch if the content did not change", func() {
+		setCABundle("drifted")
+		swap("02", "ca-1")
+
+		Ω(w.handleEvent(dataEvent())).ShouldNot(HaveOccurred())
+		Ω(caBundle()).Should(Equal("drifted"))
+	})
+
+	It("should ignore events of unrelated files", func() {
+		Ω(os.WriteFile(w.certFile, []byte("ca-2"), 0o600)).ShouldNot(HaveOccurred())
+
+		Ω(w.handleEvent(&fsnotify.Event{Name: filepath.Join(dir, "other"), Op: fsnotify.Write})).ShouldNot(HaveOccurred())
+		Ω(caBundle()).Should(Equal("ca-1"))
+	})
+	It("should collapse bursts of events into one sync", func() {
+		var err error
+		w.opts.CAWatchDebounce = 200 * time.Millisecond
+		w.caWatcher, err = fsnotify.NewWatcher()
+		Ω(err).ShouldNot(HaveOccurred())
+		DeferCleanup(w.caWatcher.Close)
+		Ω(w.caWatcher.Add(dir)).ShouldNot(HaveOccurred())
+		go w.watchCA()
+
+		swap("02", "ca-2")
+		Ω(os.Remove(filepath.Join(dir, "..2026_01", certs.CACert))).ShouldNot(HaveOccurred())
+		swap("03", "ca-3")
+
+		Eventually(caBundle).Should(Equal("ca-3"))
+		Consistently(patches.Load, 500*time.Millisecond).Should(BeEquivalentTo(1))
+	})
+})
@@ -0,0 +1,70 @@
+package watcher
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// SetupWithManager adds the watcher to the manager and sets up a controller that watches the ca injection targets.
+// The ca bundle is re-applied whenever a target is created or its ca bundle drifts from the current ca cert.
+func (w *watcher) SetupWithManager(mgr ctrl.Manager) error {
+	if w.client == nil {
+		w.client = mgr.GetClient()
+	}
+	if w.config == nil {
+		w.config = mgr.GetConfig()
+	}
+	if w.logger.GetSink() == nil {
+		w.logger = mgr.GetLogger().WithName(eventSource)
+	}
+	if w.recorder == nil {
+		w.recorder = mgr.GetEventRecorderFor(eventSource) //nolint:staticcheck
+	}
+
+	w.checkWebhookAPI()
+
+	if err := mgr.Add(w); err != nil {
+		return err
+	}
+
+	// all events are mapped to the same request, as each sync handles all targets
+	enqueue := handler.EnqueueRequestsFromMapFunc(func(context.Context, client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: w.opts.Name}}}
+	})
+
+	needLeaderElection := w.NeedLeaderElection()
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named("ca-injector-" + w.opts.Name).
+		WithOptions(controller.Options{NeedLeaderElection: &needLeaderElection})
+
+	// only the metadata of the targets is cached, as the targets are read live on each sync
+	for _, t := range w.targets {
+		b = b.Watches(t.Object(), enqueue,
+			builder.OnlyMetadata,
+			builder.WithPredicates(predicate.NewPredicateFuncs(t.Matches)),
+		)
+	}
+
+	src, err := w.setupCASource(mgr, enqueue)
+	if err != nil {
+		return err
+	}
+	if src != nil {
+		b = b.WatchesRawSource(src)
+	}
+
+	return b.Complete(w)
+}
+
+// Reconcile re-applies the current ca cert to all targets
+func (w *watcher) Reconcile(_ context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	return reconcile.Result{}, w.syncHooks()
+}
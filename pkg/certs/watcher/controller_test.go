@@ -0,0 +1,175 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/bakito/operator-utils/pkg/certs/metrics"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	arv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Controller", func() {
+	var (
+		w        *watcher
+		ctx      context.Context
+		mwc      *arv1.MutatingWebhookConfiguration
+		recorder *record.FakeRecorder
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		mwc = &arv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"app": "test"}},
+			Webhooks: []arv1.MutatingWebhook{{
+				Name:         "a.example.com",
+				ClientConfig: arv1.WebhookClientConfig{CABundle: []byte("drifted")},
+			}},
+		}
+		o := certs.Options{
+			CertDir:                         GinkgoT().TempDir(),
+			ValidatingWebhookConfigOptional: true,
+		}
+		recorder = record.NewFakeRecorder(10)
+		w = New(o.ApplyDefaults("test"),
+			WithClient(fake.NewClientBuilder().WithObjects(mwc).Build()),
+			WithLogger(logr.Discard()),
+			WithEventRecorder(recorder),
+		).(*watcher)
+		Ω(os.WriteFile(filepath.Join(w.opts.CertDir, w.opts.CACert), []byte("ca"), 0o600)).ShouldNot(HaveOccurred())
+	})
+
+	It("should revert the ca bundle drift", func() {
+		patched := metrics.CAInjections.WithLabelValues("test", "MutatingWebhookConfiguration", mwc.Name,
+			metrics.ResultSuccess)
+		before := testutil.ToFloat64(patched)
+
+		_, err := w.Reconcile(ctx, reconcile.Request{})
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = w.Reconcile(ctx, reconcile.Request{})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(testutil.ToFloat64(patched)).Should(Equal(before + 1))
+		Ω(testutil.ToFloat64(metrics.LastSync.WithLabelValues("test"))).
+			Should(BeNumerically("~", time.Now().Unix(), 5))
+		Ω(recorder.Events).Should(Receive(Equal("Normal CABundleInjected CA bundle was injected")))
+
+		c := &arv1.MutatingWebhookConfiguration{}
+		Ω(w.client.Get(ctx, types.NamespacedName{Name: mwc.Name}, c)).ShouldNot(HaveOccurred())
+		Ω(c.Webhooks[0].ClientConfig.CABundle).Should(Equal([]byte("ca")))
+	})
+
+	It("should not patch an empty ca bundle", func() {
+		Ω(os.WriteFile(w.certFile, nil, 0o600)).ShouldNot(HaveOccurred())
+		_, err := w.Reconcile(ctx, reconcile.Request{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		c := &arv1.MutatingWebhookConfiguration{}
+		Ω(w.client.Get(ctx, types.NamespacedName{Name: mwc.Name}, c)).ShouldNot(HaveOccurred())
+		Ω(c.Webhooks[0].ClientConfig.CABundle).Should(Equal([]byte("drifted")))
+	})
+
+	It("should not start without a client", func() {
+		Ω(New(w.opts).Start(ctx)).Should(MatchError(ContainSubstring("no client")))
+	})
+
+	It("should start on an empty cert dir and sync once the ca cert is created", func() {
+		o := w.opts
+		o.CertDir = filepath.Join(GinkgoT().TempDir(), "certs")
+		o.CAWatchDebounce = -1
+		ww := New(o, WithClient(w.client), WithLogger(logr.Discard())).(*watcher)
+
+		startCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		started := make(chan error, 1)
+		go func() { started <- ww.Start(startCtx) }()
+
+		Eventually(ww.LastError).Should(MatchError(os.ErrNotExist))
+		Consistently(started, 100*time.Millisecond).ShouldNot(Receive())
+
+		Ω(os.WriteFile(filepath.Join(o.CertDir, o.CACert), []byte("ca"), 0o600)).ShouldNot(HaveOccurred())
+		Eventually(ww.LastError).ShouldNot(HaveOccurred())
+		c := &arv1.MutatingWebhookConfiguration{}
+		Ω(w.client.Get(ctx, types.NamespacedName{Name: mwc.Name}, c)).ShouldNot(HaveOccurred())
+		Ω(c.Webhooks[0].ClientConfig.CABundle).Should(Equal([]byte("ca")))
+
+		cancel()
+		Eventually(started).Should(Receive(BeNil()))
+	})
+
+	It("should add custom targets", func() {
+		t := ConversionCRDTarget(w.opts)
+		ww := New(w.opts, WithTargets(t)).(*watcher)
+		Ω(ww.targets).Should(HaveLen(3))
+		Ω(ww.targets[2]).Should(BeIdenticalTo(t))
+	})
+
+	It("should need leader election if configured", func() {
+		Ω(w.NeedLeaderElection()).Should(BeFalse())
+		w.opts.WatcherLeaderElection = true
+		Ω(w.NeedLeaderElection()).Should(BeTrue())
+	})
+
+	It("should match the targets by name or selector", func() {
+		Ω(matches(mwc, nil, "test")).Should(BeTrue())
+		Ω(matches(mwc, nil, "other")).Should(BeFalse())
+		Ω(matches(mwc, &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}})).Should(BeTrue())
+		Ω(matches(mwc, &metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}})).Should(BeFalse())
+	})
+
+	Context("retry", func() {
+		var failures int
+		BeforeEach(func() {
+			failures = 0
+			w.opts.PatchBackoff = time.Millisecond
+			w.client = fake.NewClientBuilder().WithObjects(mwc).WithInterceptorFuncs(interceptor.Funcs{
+				Patch: func(
+					ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption,
+				) error {
+					if failures > 0 {
+						failures--
+						return errors.New("transient error")
+					}
+					return c.Patch(ctx, obj, patch, opts...)
+				},
+			}).Build()
+		})
+
+		It("should retry after transient errors", func() {
+			failures = 2
+			_, err := w.Reconcile(ctx, reconcile.Request{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(w.LastError()).ShouldNot(HaveOccurred())
+			Ω(failures).Should(BeZero())
+		})
+
+		It("should expose the last error if all attempts fail", func() {
+			failed := metrics.CASyncFailures.WithLabelValues("test")
+			before := testutil.ToFloat64(failed)
+			failedPatches := metrics.CAInjections.WithLabelValues("test", "MutatingWebhookConfiguration", mwc.Name,
+				metrics.ResultFailure)
+			patchesBefore := testutil.ToFloat64(failedPatches)
+
+			failures = w.opts.PatchRetries
+			_, err := w.Reconcile(ctx, reconcile.Request{})
+			Ω(err).Should(MatchError(ContainSubstring("transient error")))
+			Ω(w.LastError()).Should(MatchError(ContainSubstring("transient error")))
+			Ω(testutil.ToFloat64(failed)).Should(Equal(before + 1))
+			Ω(testutil.ToFloat64(failedPatches)).Should(Equal(patchesBefore + float64(w.opts.PatchRetries)))
+			Ω(recorder.Events).Should(Receive(ContainSubstring("Warning CABundleInjectionFailed")))
+		})
+	})
+})
@@ -0,0 +1,29 @@
+package watcher
+
+import (
+	"github.com/bakito/operator-utils/pkg/certs"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var crdGVK = schema.GroupVersionKind{
+	Group:   "apiextensions.k8s.io",
+	Version: "v1",
+	Kind:    "CustomResourceDefinition",
+}
+
+// ConversionCRDTarget injects the ca cert into the conversion webhooks of the CRDs listed in ConversionCRDNames
+func ConversionCRDTarget(opts certs.Options) Target {
+	return &namedTarget{
+		gvk:      crdGVK,
+		names:    opts.ConversionCRDNames,
+		optional: optionalNames{all: opts.ConversionCRDsOptional, names: opts.ConversionCRDOptionalNames},
+		caBundle: []string{"spec", "conversion", "webhook", "clientConfig", "caBundle"},
+		skip: func(crd *unstructured.Unstructured) string {
+			if strategy, _, _ := unstructured.NestedString(crd.Object, "spec", "conversion", "strategy"); strategy != "Webhook" {
+				return "CRD has no conversion webhook"
+			}
+			return ""
+		},
+	}
+}
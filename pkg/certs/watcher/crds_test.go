@@ -0,0 +1,79 @@
+package watcher
+
+import (
+	"context"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("CRDs", func() {
+	var (
+		c   client.Client
+		ctx context.Context
+		crd *unstructured.Unstructured
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		crd = &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "tests.example.com"},
+			"spec": map[string]interface{}{
+				"conversion": map[string]interface{}{
+					"strategy": "Webhook",
+					"webhook": map[string]interface{}{
+						"clientConfig": map[string]interface{}{
+							"service": map[string]interface{}{"name": "test", "namespace": "test-ns"},
+						},
+					},
+				},
+			},
+		}}
+		crd.SetGroupVersionKind(crdGVK)
+		c = fake.NewClientBuilder().WithObjects(crd).Build()
+	})
+
+	inject := func(names ...string) (bool, error) {
+		return ConversionCRDTarget(certs.Options{ConversionCRDNames: names}).Inject(ctx, c, []byte("ca"))
+	}
+
+	getCABundle := func() string {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(crdGVK)
+		Ω(c.Get(ctx, types.NamespacedName{Name: crd.GetName()}, u)).ShouldNot(HaveOccurred())
+		caBundle, _, _ := unstructured.NestedString(u.Object, "spec", "conversion", "webhook", "clientConfig", "caBundle")
+		return caBundle
+	}
+
+	It("should inject the ca bundle", func() {
+		Ω(inject(crd.GetName())).Should(BeFalse())
+		Ω(getCABundle()).Should(Equal("Y2E="))
+	})
+
+	It("should check the ca bundle", func() {
+		t := ConversionCRDTarget(certs.Options{ConversionCRDNames: []string{crd.GetName()}})
+		Ω(t.Check(ctx, c, []byte("ca"))).Should(MatchError(ContainSubstring(`CustomResourceDefinition "tests.example.com"`)))
+		Ω(getCABundle()).Should(BeEmpty())
+
+		Ω(inject(crd.GetName())).Should(BeFalse())
+		Ω(t.Check(ctx, c, []byte("ca"))).ShouldNot(HaveOccurred())
+	})
+
+	It("should not inject the ca bundle without a conversion webhook", func() {
+		Ω(unstructured.SetNestedField(crd.Object, "None", "spec", "conversion", "strategy")).ShouldNot(HaveOccurred())
+		Ω(c.Update(ctx, crd)).ShouldNot(HaveOccurred())
+
+		Ω(inject(crd.GetName())).Should(BeFalse())
+		Ω(getCABundle()).Should(BeEmpty())
+	})
+
+	It("should fail if the CRD does not exist", func() {
+		_, err := inject("unknown.example.com")
+		Ω(err).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,58 @@
+package watcher
+
+import (
+	"fmt"
+
+	arv1 "k8s.io/api/admissionregistration/v1"
+	arv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+// checkWebhookAPI logs an error if the api version of the webhook targets is not served by the cluster.
+// Discovery failures are only logged, as they must not prevent the watcher from starting.
+func (w *watcher) checkWebhookAPI() {
+	if w.config == nil {
+		return
+	}
+	gv := arv1.SchemeGroupVersion
+	if w.opts.LegacyWebhookV1beta1 {
+		gv = arv1beta1.SchemeGroupVersion
+	}
+
+	served, err := w.servesVersion(gv)
+	if err != nil {
+		w.logger.Error(err, "Could not discover the webhook api versions served by the cluster")
+		return
+	}
+	if !served {
+		w.logger.Error(fmt.Errorf("api version %q is not served", gv), "Webhook configurations can not be injected")
+	}
+}
+
+func (w *watcher) servesVersion(gv schema.GroupVersion) (bool, error) {
+	dcl, err := discovery.NewDiscoveryClientForConfig(w.config)
+	if err != nil {
+		return false, err
+	}
+	apiList, err := dcl.ServerGroups()
+	if err != nil {
+		return false, err
+	}
+	return servesVersion(apiList, gv)
+}
+
+func servesVersion(apiList *metav1.APIGroupList, gv schema.GroupVersion) (bool, error) {
+	for _, g := range apiList.Groups {
+		if g.Name == gv.Group {
+			for _, v := range g.Versions {
+				if v.Version == gv.Version {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("could not find api group %q", gv.Group)
+}
@@ -0,0 +1,29 @@
+package watcher
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	arv1 "k8s.io/api/admissionregistration/v1"
+	arv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Discovery", func() {
+	apiList := &metav1.APIGroupList{Groups: []metav1.APIGroup{{
+		Name:     arv1.GroupName,
+		Versions: []metav1.GroupVersionForDiscovery{{Version: "v1"}},
+	}}}
+
+	It("should find the served version", func() {
+		Ω(servesVersion(apiList, arv1.SchemeGroupVersion)).Should(BeTrue())
+	})
+
+	It("should not find a removed version", func() {
+		Ω(servesVersion(apiList, arv1beta1.SchemeGroupVersion)).Should(BeFalse())
+	})
+
+	It("should fail for an unknown group", func() {
+		_, err := servesVersion(&metav1.APIGroupList{}, arv1.SchemeGroupVersion)
+		Ω(err).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,35 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// Checker returns a checker verifying that all ca injection targets carry the current ca cert
+func (w *watcher) Checker() healthz.Checker {
+	return func(req *http.Request) error {
+		if w.client == nil {
+			return errors.New("the ca watcher is not set up")
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), w.opts.PatchTimeout)
+		defer cancel()
+
+		caCert, err := w.readCA(ctx)
+		if err != nil {
+			return err
+		}
+		if len(caCert) == 0 {
+			return errors.New("the ca cert is empty")
+		}
+
+		for _, t := range w.targets {
+			if err := t.Check(ctx, w.client, caCert); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	arv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Healthz", func() {
+	var (
+		w   *watcher
+		req *http.Request
+	)
+
+	BeforeEach(func() {
+		var err error
+		req, err = http.NewRequestWithContext(context.TODO(), http.MethodGet, "/readyz", http.NoBody)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		o := certs.Options{
+			CertDir:                         GinkgoT().TempDir(),
+			ValidatingWebhookConfigOptional: true,
+		}
+		w = New(o.ApplyDefaults("test"),
+			WithClient(fake.NewClientBuilder().WithObjects(&arv1.MutatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Webhooks: []arv1.MutatingWebhook{{
+					Name:         "a.example.com",
+					ClientConfig: arv1.WebhookClientConfig{CABundle: []byte("drifted")},
+				}},
+			}).Build()),
+			WithLogger(logr.Discard()),
+		).(*watcher)
+		Ω(os.WriteFile(filepath.Join(w.opts.CertDir, w.opts.CACert), []byte("ca"), 0o600)).ShouldNot(HaveOccurred())
+	})
+
+	It("should fail if a target does not carry the current ca cert", func() {
+		Ω(w.Checker()(req)).Should(MatchError(ContainSubstring(`MutatingWebhookConfiguration "test"`)))
+	})
+
+	It("should succeed once the ca cert is injected", func() {
+		_, err := w.Reconcile(req.Context(), reconcile.Request{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(w.Checker()(req)).ShouldNot(HaveOccurred())
+	})
+
+	It("should check the targets without injecting the ca cert", func() {
+		t := &checkTarget{err: errors.New("not injected")}
+		w.targets = []Target{t}
+		Ω(w.Checker()(req)).Should(MatchError("not injected"))
+		Ω(t.checked).Should(BeTrue())
+	})
+
+	It("should fail without a ca cert", func() {
+		Ω(os.Remove(w.certFile)).ShouldNot(HaveOccurred())
+		Ω(w.Checker()(req)).Should(HaveOccurred())
+	})
+})
+
+// checkTarget is a target that fails if the ca cert is injected
+type checkTarget struct {
+	err     error
+	checked bool
+}
+
+func (t *checkTarget) Object() client.Object {
+	return &arv1.MutatingWebhookConfiguration{}
+}
+
+func (t *checkTarget) Matches(client.Object) bool {
+	return false
+}
+
+func (t *checkTarget) Inject(context.Context, client.Client, []byte) (bool, error) {
+	Fail("the ca cert must not be injected by the checker")
+	return false, nil
+}
+
+func (t *checkTarget) Check(context.Context, client.Reader, []byte) error {
+	t.checked = true
+	return t.err
+}
@@ -0,0 +1,110 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/bakito/operator-utils/pkg/log"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// namedTarget injects the ca cert into a single ca bundle field of the objects with the configured names
+type namedTarget struct {
+	gvk      schema.GroupVersionKind
+	names    []string
+	optional optionalNames
+	// caBundle the path of the ca bundle field
+	caBundle []string
+	// skip returns the reason, why the ca cert is not injected into the object, empty if it is injected
+	skip func(obj *unstructured.Unstructured) string
+}
+
+func (t *namedTarget) Object() client.Object {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(t.gvk)
+	return u
+}
+
+func (t *namedTarget) Matches(obj client.Object) bool {
+	return matches(obj, nil, t.names...)
+}
+
+// Inject updates the ca bundle of the configured objects
+func (t *namedTarget) Inject(ctx context.Context, c client.Client, caCert []byte) (bool, error) {
+	stale, missing, err := t.stale(ctx, c, caCert)
+	if err != nil {
+		return missing, err
+	}
+	for _, obj := range stale {
+		log.With(logr.FromContextOrDiscard(ctx), obj).Info("Updating ca cert")
+		err = t.patch(ctx, c, obj, caCert)
+		RecordInjection(ctx, obj, err)
+		if err != nil {
+			return missing, err
+		}
+	}
+	return missing, nil
+}
+
+func (t *namedTarget) Check(ctx context.Context, c client.Reader, caCert []byte) error {
+	stale, _, err := t.stale(ctx, c, caCert)
+	if err != nil {
+		return err
+	}
+	if len(stale) > 0 {
+		return notInjectedError(stale[0])
+	}
+	return nil
+}
+
+// stale returns the configured objects not carrying the ca cert
+func (t *namedTarget) stale(
+	ctx context.Context,
+	c client.Reader,
+	caCert []byte,
+) ([]*unstructured.Unstructured, bool, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	var stale []*unstructured.Unstructured
+	missing := false
+	for _, name := range t.names {
+		obj := t.Object().(*unstructured.Unstructured)
+		found, err := getObject(ctx, c, name, obj, t.optional.optional(name))
+		if err != nil {
+			return nil, missing, err
+		}
+		if !found {
+			missing = true
+			continue
+		}
+
+		if reason := t.skip(obj); reason != "" {
+			log.With(logger, obj).Info("Skipping ca injection", "reason", reason)
+			continue
+		}
+
+		current, _, _ := unstructured.NestedString(obj.Object, t.caBundle...)
+		if ShouldInject(ctx, decodeCABundle(current), caCert) {
+			stale = append(stale, obj)
+		}
+	}
+	return stale, missing, nil
+}
+
+func (t *namedTarget) patch(ctx context.Context, c client.Client, obj client.Object, cert []byte) error {
+	// build the nested patch from the innermost field outwards
+	var patch interface{} = cert
+	for i := len(t.caBundle) - 1; i >= 0; i-- {
+		patch = map[string]interface{}{t.caBundle[i]: patch}
+	}
+
+	mergePatch, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	return c.Patch(ctx, obj, client.RawPatch(types.MergePatchType, mergePatch))
+}
@@ -0,0 +1,59 @@
+package watcher
+
+import (
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Option configures the watcher
+type Option func(w *watcher)
+
+const eventSource = "ca-injector"
+
+// WithManager takes the client, config, logger and event recorder from the manager
+func WithManager(mgr ctrl.Manager) Option {
+	return func(w *watcher) {
+		w.client = mgr.GetClient()
+		w.config = mgr.GetConfig()
+		w.logger = mgr.GetLogger().WithName(eventSource)
+		w.recorder = mgr.GetEventRecorderFor(eventSource) //nolint:staticcheck
+	}
+}
+
+// WithClient sets the client used to patch the ca injection targets
+func WithClient(c client.Client) Option {
+	return func(w *watcher) {
+		w.client = c
+	}
+}
+
+// WithConfig sets the rest config used to discover the api versions served by the cluster
+func WithConfig(cfg *rest.Config) Option {
+	return func(w *watcher) {
+		w.config = cfg
+	}
+}
+
+// WithLogger sets the logger
+func WithLogger(l logr.Logger) Option {
+	return func(w *watcher) {
+		w.logger = l
+	}
+}
+
+// WithEventRecorder sets the recorder for the events on the ca injection targets
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(w *watcher) {
+		w.recorder = recorder
+	}
+}
+
+// WithTargets adds custom ca injection targets
+func WithTargets(targets ...Target) Option {
+	return func(w *watcher) {
+		w.targets = append(w.targets, targets...)
+	}
+}
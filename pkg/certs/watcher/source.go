@@ -0,0 +1,69 @@
+package watcher
+
+import (
+	"context"
+	"os"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// caObject returns the object and its name the ca cert is read from, nil if the ca cert is read from a file
+func (w *watcher) caObject() (client.Object, string) {
+	switch w.opts.CASource {
+	case certs.CASourceSecret:
+		return &corev1.Secret{}, w.opts.Name
+	case certs.CASourceConfigMap:
+		return &corev1.ConfigMap{}, w.opts.CAConfigMapName
+	}
+	return nil, ""
+}
+
+// setupCASource sets up a cache restricted to the ca secret or config map and returns a source watching it.
+// nil is returned if the ca cert is read from a file.
+func (w *watcher) setupCASource(mgr ctrl.Manager, h handler.EventHandler) (source.Source, error) {
+	obj, name := w.caObject()
+	if obj == nil {
+		return nil, nil
+	}
+
+	c, err := certs.NewObjectCache(mgr, w.opts.Namespace, name, obj)
+	if err != nil {
+		return nil, err
+	}
+	w.caReader = c
+
+	return source.Kind(c, obj, h), nil
+}
+
+// readCA reads the ca cert from the configured source
+func (w *watcher) readCA(ctx context.Context) ([]byte, error) {
+	obj, name := w.caObject()
+	if obj == nil {
+		return os.ReadFile(w.certFile)
+	}
+
+	reader := w.caReader
+	if reader == nil {
+		reader = w.client
+	}
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: w.opts.Namespace, Name: name}, obj); err != nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+	case *corev1.Secret:
+		return o.Data[w.opts.CACert], nil
+	case *corev1.ConfigMap:
+		if v, ok := o.Data[w.opts.CAConfigMapKey]; ok {
+			return []byte(v), nil
+		}
+		return o.BinaryData[w.opts.CAConfigMapKey], nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,64 @@
+package watcher
+
+import (
+	"context"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("CA Source", func() {
+	var (
+		w   *watcher
+		ctx context.Context
+	)
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		w = &watcher{
+			client: fake.NewClientBuilder().WithObjects(
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "test-ns", Name: "test"},
+					Data:       map[string][]byte{certs.CACert: []byte("secret-ca")},
+				},
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "test-ns", Name: "service-ca"},
+					Data:       map[string]string{"service-ca.crt": "configmap-ca"},
+				},
+			).Build(),
+			logger: logr.Discard(),
+		}
+	})
+
+	It("should read the ca cert from the secret", func() {
+		o := certs.Options{Namespace: "test-ns", CASource: certs.CASourceSecret}
+		w.opts = o.ApplyDefaults("test")
+
+		Ω(w.readCA(ctx)).Should(Equal([]byte("secret-ca")))
+	})
+
+	It("should read the ca cert from the config map", func() {
+		o := certs.Options{
+			Namespace:       "test-ns",
+			CASource:        certs.CASourceConfigMap,
+			CAConfigMapName: "service-ca",
+			CAConfigMapKey:  "service-ca.crt",
+		}
+		w.opts = o.ApplyDefaults("test")
+
+		Ω(w.readCA(ctx)).Should(Equal([]byte("configmap-ca")))
+	})
+
+	It("should fail if the config map does not exist", func() {
+		o := certs.Options{Namespace: "test-ns", CASource: certs.CASourceConfigMap, CAConfigMapName: "unknown"}
+		w.opts = o.ApplyDefaults("test")
+
+		_, err := w.readCA(ctx)
+		Ω(err).Should(HaveOccurred())
+	})
+})
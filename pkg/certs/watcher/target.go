@@ -0,0 +1,213 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/bakito/operator-utils/pkg/certs/metrics"
+	"github.com/bakito/operator-utils/pkg/log"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Target is a kind of objects the ca cert is injected into
+type Target interface {
+	// Object returns an empty object of the target kind, used to watch the target objects for ca bundle drift
+	Object() client.Object
+	// Matches checks if the object is a target object. The object only carries the metadata of the target.
+	Matches(obj client.Object) bool
+	// Inject injects the ca cert into all target objects and calls RecordInjection for each patched object.
+	// The logger and the event recorder are passed within the context.
+	// missing is true if an optional target object does not exist.
+	Inject(ctx context.Context, c client.Client, caCert []byte) (missing bool, err error)
+	// Check checks without any writes, that all target objects carry the ca cert.
+	// Missing optional target objects are ignored.
+	Check(ctx context.Context, c client.Reader, caCert []byte) error
+}
+
+type (
+	onlyNewerKey struct{}
+	injectionKey struct{}
+)
+
+// injection the watcher the ca bundle is injected by
+type injection struct {
+	name     string
+	recorder record.EventRecorder
+}
+
+// withInjection returns a context, in which RecordInjection counts the patches for the watcher with the name
+// and records the events with the recorder
+func withInjection(ctx context.Context, name string, recorder record.EventRecorder) context.Context {
+	return context.WithValue(ctx, injectionKey{}, injection{name: name, recorder: recorder})
+}
+
+// RecordInjection counts the patch of the target object by result and records an event on it,
+// whether the ca bundle could be injected
+func RecordInjection(ctx context.Context, obj client.Object, err error) {
+	inj, ok := ctx.Value(injectionKey{}).(injection)
+	if !ok {
+		return
+	}
+	result := metrics.ResultSuccess
+	if err != nil {
+		result = metrics.ResultFailure
+	}
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	metrics.CAInjections.WithLabelValues(inj.name, kind, obj.GetName(), result).Inc()
+	if inj.recorder == nil {
+		return
+	}
+	if err != nil {
+		inj.recorder.Eventf(obj, corev1.EventTypeWarning, certs.EventReasonCABundleInjectionFailed,
+			"Injecting the ca bundle failed: %v", err)
+		return
+	}
+	inj.recorder.Event(obj, corev1.EventTypeNormal, certs.EventReasonCABundleInjected, "CA bundle was injected")
+}
+
+// withOnlyNewer returns a context, in which ShouldInject only allows newer ca certs to be injected
+func withOnlyNewer(ctx context.Context) context.Context {
+	return context.WithValue(ctx, onlyNewerKey{}, true)
+}
+
+// ShouldInject checks if the ca cert should replace the current ca bundle of a target object.
+// If the watcher is not leader-elected, the ca cert is only injected if it is newer than the current ca bundle,
+// so replicas with differently timed volume updates do not flap the ca bundle.
+func ShouldInject(ctx context.Context, current, caCert []byte) bool {
+	if bytes.Equal(current, caCert) {
+		return false
+	}
+	if onlyNewer, _ := ctx.Value(onlyNewerKey{}).(bool); !onlyNewer {
+		return true
+	}
+	return newerBundle(caCert, current)
+}
+
+// newerBundle checks if the ca bundle is newer than the other ca bundle, judged by the NotBefore of the newest
+// and then the oldest cert. The oldest cert distinguishes a bundle whose old ca was dropped after a ca rotation.
+func newerBundle(bundle, other []byte) bool {
+	otherNewest, otherOldest, ok := bundleAge(other)
+	if !ok {
+		return true
+	}
+	newest, oldest, ok := bundleAge(bundle)
+	if !ok {
+		return false
+	}
+	if !newest.Equal(otherNewest) {
+		return newest.After(otherNewest)
+	}
+	return oldest.After(otherOldest)
+}
+
+// bundleAge returns the NotBefore of the newest and the oldest cert of the ca bundle
+func bundleAge(bundle []byte) (newest, oldest time.Time, ok bool) {
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return newest, oldest, ok
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		if !ok || cert.NotBefore.After(newest) {
+			newest = cert.NotBefore
+		}
+		if !ok || cert.NotBefore.Before(oldest) {
+			oldest = cert.NotBefore
+		}
+		ok = true
+	}
+}
+
+// decodeCABundle decodes the base64 encoded ca bundle of an unstructured object
+func decodeCABundle(current string) []byte {
+	decoded, err := base64.StdEncoding.DecodeString(current)
+	if err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// defaultTargets returns the targets configured by the options
+func defaultTargets(opts certs.Options) []Target {
+	var targets []Target
+	if opts.LegacyWebhookV1beta1 {
+		targets = append(targets, LegacyMutatingWebhookTarget(opts), LegacyValidatingWebhookTarget(opts))
+	} else {
+		targets = append(targets, MutatingWebhookTarget(opts), ValidatingWebhookTarget(opts))
+	}
+	if len(opts.ConversionCRDNames) > 0 {
+		targets = append(targets, ConversionCRDTarget(opts))
+	}
+	if len(opts.APIServiceNames) > 0 {
+		targets = append(targets, APIServiceTarget(opts))
+	}
+	return targets
+}
+
+// optionalNames decides which target objects may be missing
+type optionalNames struct {
+	// all all target objects may be missing
+	all   bool
+	names []string
+}
+
+func (o optionalNames) optional(name string) bool {
+	return o.all || slices.Contains(o.names, name)
+}
+
+// getObject gets the target object by name. If an optional object is missing, it is logged and
+// false is returned. Missing objects are re-checked periodically.
+func getObject(ctx context.Context, c client.Reader, name string, obj client.Object, optional bool) (bool, error) {
+	err := c.Get(ctx, types.NamespacedName{Name: name}, obj)
+	if err == nil {
+		return true, nil
+	}
+	if optional && apierrors.IsNotFound(err) {
+		obj.SetName(name)
+		log.With(logr.FromContextOrDiscard(ctx), obj).Info("Optional ca injection target not found, will re-check later")
+		return false, nil
+	}
+	return false, err
+}
+
+// notInjectedError returns the error of a target object not carrying the ca cert
+func notInjectedError(obj client.Object) error {
+	return fmt.Errorf("%s %q does not carry the current ca cert", obj.GetObjectKind().GroupVersionKind().Kind,
+		obj.GetName())
+}
+
+// matches checks if the object matches by name or label selector
+func matches(obj client.Object, selector *metav1.LabelSelector, names ...string) bool {
+	if slices.Contains(names, obj.GetName()) {
+		return true
+	}
+	if selector == nil {
+		return false
+	}
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false
+	}
+	return sel.Matches(labels.Set(obj.GetLabels()))
+}
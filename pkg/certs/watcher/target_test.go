@@ -0,0 +1,58 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	"github.com/bakito/operator-utils/pkg/certs/certstest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Target", func() {
+	var (
+		ctx      context.Context
+		now      time.Time
+		oldCA    []byte
+		newCA    []byte
+		bothCAs  []byte
+		newerCtx context.Context
+	)
+
+	caCert := func(notBefore time.Time) []byte {
+		cert, _, err := certstest.SelfSigned("ca", notBefore)
+		Ω(err).ShouldNot(HaveOccurred())
+		return cert
+	}
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		newerCtx = withOnlyNewer(ctx)
+		now = time.Now().Truncate(time.Second)
+		oldCA = caCert(now.Add(-time.Hour))
+		newCA = caCert(now)
+		bothCAs = append(append([]byte{}, oldCA...), newCA...)
+	})
+
+	It("should inject any different ca cert by default", func() {
+		Ω(ShouldInject(ctx, newCA, oldCA)).Should(BeTrue())
+		Ω(ShouldInject(ctx, oldCA, oldCA)).Should(BeFalse())
+	})
+
+	It("should only inject newer ca certs if not leader-elected", func() {
+		Ω(ShouldInject(newerCtx, oldCA, newCA)).Should(BeTrue())
+		Ω(ShouldInject(newerCtx, newCA, oldCA)).Should(BeFalse())
+		Ω(ShouldInject(newerCtx, oldCA, bothCAs)).Should(BeTrue())
+	})
+
+	It("should prefer the bundle without the old ca after a ca rotation", func() {
+		Ω(ShouldInject(newerCtx, bothCAs, newCA)).Should(BeTrue())
+		Ω(ShouldInject(newerCtx, newCA, bothCAs)).Should(BeFalse())
+	})
+
+	It("should replace an invalid ca bundle, but not inject an invalid ca cert", func() {
+		Ω(ShouldInject(newerCtx, nil, newCA)).Should(BeTrue())
+		Ω(ShouldInject(newerCtx, []byte("invalid"), newCA)).Should(BeTrue())
+		Ω(ShouldInject(newerCtx, newCA, []byte("invalid"))).Should(BeFalse())
+	})
+})
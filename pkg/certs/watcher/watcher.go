@@ -2,50 +2,96 @@ package watcher
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 
 	"github.com/bakito/operator-utils/pkg/certs"
 	"github.com/fsnotify/fsnotify"
 	"github.com/go-logr/logr"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-// New create a new watcher
-func New(opts certs.Options) manager.Runnable {
+// Watcher watches the ca cert and injects it into the configured targets
+type Watcher interface {
+	manager.Runnable
+	manager.LeaderElectionRunnable
+	reconcile.Reconciler
+	// SetupWithManager adds the watcher to the manager and watches the ca injection targets for drift
+	SetupWithManager(mgr ctrl.Manager) error
+	// LastError returns the error of the last sync, nil if the last sync was successful
+	LastError() error
+	// Checker returns a checker verifying that all ca injection targets carry the current ca cert
+	Checker() healthz.Checker
+	// AddTarget adds a custom ca injection target. Targets must be added before the watcher is set up.
+	AddTarget(t Target)
+}
+
+// New create a new watcher. The client, config and logger are passed as options,
+// missing ones are taken from the manager in SetupWithManager.
+func New(opts certs.Options, options ...Option) Watcher {
 	w := &watcher{
-		opts: opts.ApplyDefaults(opts.Name),
+		opts:   opts.ApplyDefaults(opts.Name),
+		logger: logr.Discard(),
 	}
+	w.targets = defaultTargets(w.opts)
 	w.certFile = filepath.Join(opts.CertDir, opts.CACert)
+	for _, o := range options {
+		o(w)
+	}
 	return w
 }
 
 type watcher struct {
-	opts      certs.Options
-	certFile  string
-	client    client.Client
-	config    *rest.Config
-	caWatcher *fsnotify.Watcher
-	patch     func(ctx context.Context, caCert []byte) error
-	logger    logr.Logger
+	opts     certs.Options
+	certFile string
+	// certTarget the resolved path of the cert file, changes when the kubelet swaps the ..data symlink
+	certTarget string
+	client     client.Client
+	caReader   client.Reader
+	config     *rest.Config
+	recorder   record.EventRecorder
+	caWatcher  *fsnotify.Watcher
+	targets    []Target
+	// missing optional targets were missing during the last sync
+	missing atomic.Bool
+	mux     sync.Mutex
+	// syncMux ensures syncs never run concurrently
+	syncMux   sync.Mutex
+	lastError error
+	// caHash the hash of the ca cert of the last successful sync
+	caHash [sha256.Size]byte
+	logger logr.Logger
 }
 
 func (w *watcher) Start(ctx context.Context) error {
 	var err error
 
-	isV1, err := w.supportsV1()
-	if err != nil {
-		return err
+	if w.client == nil {
+		return errors.New("the ca watcher has no client, use WithManager or WithClient")
 	}
-	if isV1 {
-		w.patch = w.patchHooksV1
-	} else {
-		w.patch = w.patchHooksBeta1V1
+
+	if w.opts.CASource != certs.CASourceFile {
+		// the ca secret or config map is watched by the controller, only re-check missing targets here
+		w.logger.Info("Starting webhook ca certificate watcher", "source", w.opts.CASource)
+		w.recheckMissing(ctx)
+		return nil
 	}
 
-	if err = w.syncHooks(); err != nil {
-		return err
+	// the cert dir may not exist yet, if the certs are written by the cert dir writer
+	dir := filepath.Dir(w.certFile)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("error creating cert dir %q: %w", dir, err)
 	}
 
 	w.caWatcher, err = fsnotify.NewWatcher()
@@ -53,7 +99,16 @@ func (w *watcher) Start(ctx context.Context) error {
 		return err
 	}
 
-	if err := w.caWatcher.Add(w.certFile); err != nil {
+	// watch the directory, as secret volumes are updated by atomically swapping the ..data symlink.
+	// The watch is added before the initial sync, so a ca cert created in between is not missed.
+	w.certTarget, _ = filepath.EvalSymlinks(w.certFile)
+	if err := w.caWatcher.Add(dir); err != nil {
+		_ = w.caWatcher.Close()
+		return err
+	}
+
+	if err = w.syncHooks(); err != nil {
+		_ = w.caWatcher.Close()
 		return err
 	}
 
@@ -65,21 +120,12 @@ func (w *watcher) Start(ctx context.Context) error {
 	return w.caWatcher.Close()
 }
 
-func (w *watcher) NeedLeaderElection() bool {
-	return false
+// AddTarget adds a custom ca injection target
+func (w *watcher) AddTarget(t Target) {
+	w.targets = append(w.targets, t)
 }
 
-func (w *watcher) InjectClient(c client.Client) error {
-	w.client = c
-	return nil
-}
-
-func (w *watcher) InjectConfig(c *rest.Config) error {
-	w.config = c
-	return nil
-}
-
-func (w *watcher) InjectLogger(l logr.Logger) error {
-	w.logger = l
-	return nil
+// NeedLeaderElection the ca is only injected by the leader if WatcherLeaderElection is enabled
+func (w *watcher) NeedLeaderElection() bool {
+	return w.opts.WatcherLeaderElection
 }
@@ -0,0 +1,230 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	"github.com/bakito/operator-utils/pkg/log"
+	"github.com/go-logr/logr"
+	arv1 "k8s.io/api/admissionregistration/v1"
+	arv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MutatingWebhookTarget injects the ca cert into the admissionregistration.k8s.io/v1 MutatingWebhookConfigurations
+func MutatingWebhookTarget(opts certs.Options) Target {
+	return mutatingWebhookTarget(opts, arv1.SchemeGroupVersion)
+}
+
+// ValidatingWebhookTarget injects the ca cert into the admissionregistration.k8s.io/v1 ValidatingWebhookConfigurations
+func ValidatingWebhookTarget(opts certs.Options) Target {
+	return validatingWebhookTarget(opts, arv1.SchemeGroupVersion)
+}
+
+// LegacyMutatingWebhookTarget injects the ca cert into the admissionregistration.k8s.io/v1beta1
+// MutatingWebhookConfigurations, which were removed in Kubernetes 1.22
+func LegacyMutatingWebhookTarget(opts certs.Options) Target {
+	return mutatingWebhookTarget(opts, arv1beta1.SchemeGroupVersion)
+}
+
+// LegacyValidatingWebhookTarget injects the ca cert into the admissionregistration.k8s.io/v1beta1
+// ValidatingWebhookConfigurations, which were removed in Kubernetes 1.22
+func LegacyValidatingWebhookTarget(opts certs.Options) Target {
+	return validatingWebhookTarget(opts, arv1beta1.SchemeGroupVersion)
+}
+
+func mutatingWebhookTarget(opts certs.Options, gv schema.GroupVersion) *webhookTarget {
+	return &webhookTarget{
+		gvk:      gv.WithKind("MutatingWebhookConfiguration"),
+		names:    append([]string{opts.MutatingWebhookConfigName}, opts.MutatingWebhookConfigNames...),
+		selector: opts.MutatingWebhookConfigSelector,
+		optional: optionalNames{all: opts.MutatingWebhookConfigOptional, names: opts.MutatingWebhookConfigOptionalNames},
+		opts:     opts,
+	}
+}
+
+func validatingWebhookTarget(opts certs.Options, gv schema.GroupVersion) *webhookTarget {
+	return &webhookTarget{
+		gvk:      gv.WithKind("ValidatingWebhookConfiguration"),
+		names:    append([]string{opts.ValidatingWebhookConfigName}, opts.ValidatingWebhookConfigNames...),
+		selector: opts.ValidatingWebhookConfigSelector,
+		optional: optionalNames{all: opts.ValidatingWebhookConfigOptional, names: opts.ValidatingWebhookConfigOptionalNames},
+		opts:     opts,
+	}
+}
+
+// webhookTarget handles mutating and validating webhook configurations of all versions,
+// as they share the same structure
+type webhookTarget struct {
+	gvk      schema.GroupVersionKind
+	names    []string
+	selector *metav1.LabelSelector
+	optional optionalNames
+	opts     certs.Options
+}
+
+func (t *webhookTarget) Object() client.Object {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(t.gvk)
+	return u
+}
+
+func (t *webhookTarget) Matches(obj client.Object) bool {
+	return matches(obj, t.selector, t.names...)
+}
+
+func (t *webhookTarget) Inject(ctx context.Context, c client.Client, caCert []byte) (bool, error) {
+	stale, missing, err := t.stale(ctx, c, caCert)
+	if err != nil {
+		return missing, err
+	}
+	for _, s := range stale {
+		err = t.patch(ctx, c, s.config, s.webhookNames, caCert)
+		RecordInjection(ctx, s.config, err)
+		if err != nil {
+			return missing, err
+		}
+	}
+	return missing, nil
+}
+
+func (t *webhookTarget) Check(ctx context.Context, c client.Reader, caCert []byte) error {
+	stale, _, err := t.stale(ctx, c, caCert)
+	if err != nil {
+		return err
+	}
+	if len(stale) > 0 {
+		return notInjectedError(stale[0].config)
+	}
+	return nil
+}
+
+// staleConfig a webhook configuration with the names of the webhooks not carrying the ca cert
+type staleConfig struct {
+	config       *unstructured.Unstructured
+	webhookNames []string
+}
+
+// stale returns the webhook configurations with webhooks not carrying the ca cert
+func (t *webhookTarget) stale(ctx context.Context, c client.Reader, caCert []byte) ([]staleConfig, bool, error) {
+	names, err := t.configNames(ctx, c)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var stale []staleConfig
+	missing := false
+	for _, name := range names {
+		whc := t.Object().(*unstructured.Unstructured)
+		found, err := getObject(ctx, c, name, whc, t.optional.optional(name))
+		if err != nil {
+			return nil, missing, err
+		}
+		if !found {
+			missing = true
+			continue
+		}
+
+		webhooks, _, _ := unstructured.NestedSlice(whc.Object, "webhooks")
+		var webhookNames []string
+		for _, wh := range webhooks {
+			webhook, ok := wh.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(webhook, "name")
+			current, _, _ := unstructured.NestedString(webhook, "clientConfig", "caBundle")
+			if t.selectWebhook(webhook) && ShouldInject(ctx, decodeCABundle(current), caCert) {
+				webhookNames = append(webhookNames, name)
+			}
+		}
+
+		if len(webhookNames) > 0 {
+			stale = append(stale, staleConfig{config: whc, webhookNames: webhookNames})
+		}
+	}
+	return stale, missing, nil
+}
+
+// configNames returns the names of the webhook configurations.
+// These are the configured names and the names of the configurations matching the selector.
+func (t *webhookTarget) configNames(ctx context.Context, c client.Reader) ([]string, error) {
+	var result []string
+	for _, name := range t.names {
+		if name != "" && !slices.Contains(result, name) {
+			result = append(result, name)
+		}
+	}
+	if t.selector == nil {
+		return result, nil
+	}
+
+	sel, err := metav1.LabelSelectorAsSelector(t.selector)
+	if err != nil {
+		return nil, err
+	}
+	list := &metav1.PartialObjectMetadataList{}
+	list.SetGroupVersionKind(t.gvk.GroupVersion().WithKind(t.gvk.Kind + "List"))
+	if err := c.List(ctx, list, client.MatchingLabelsSelector{Selector: sel}); err != nil {
+		return nil, err
+	}
+	for _, item := range list.Items {
+		if !slices.Contains(result, item.Name) {
+			result = append(result, item.Name)
+		}
+	}
+	return result, nil
+}
+
+// selectWebhook checks if the webhook should be updated by its name and service reference
+func (t *webhookTarget) selectWebhook(webhook map[string]interface{}) bool {
+	name, _, _ := unstructured.NestedString(webhook, "name")
+	if len(t.opts.WebhookNames) > 0 && !slices.Contains(t.opts.WebhookNames, name) {
+		return false
+	}
+	svcName, hasSvcName, _ := unstructured.NestedString(webhook, "clientConfig", "service", "name")
+	if t.opts.WebhookServiceName != "" && (!hasSvcName || svcName != t.opts.WebhookServiceName) {
+		return false
+	}
+	svcNamespace, hasSvcNamespace, _ := unstructured.NestedString(webhook, "clientConfig", "service", "namespace")
+	if t.opts.WebhookServiceNamespace != "" && (!hasSvcNamespace || svcNamespace != t.opts.WebhookServiceNamespace) {
+		return false
+	}
+	return true
+}
+
+func (t *webhookTarget) patch(
+	ctx context.Context,
+	c client.Client,
+	whc client.Object,
+	webhookNames []string,
+	cert []byte,
+) error {
+	log.With(logr.FromContextOrDiscard(ctx), whc).Info("Updating webhook ca cert")
+	var webhooks []interface{}
+	for _, name := range webhookNames {
+		webhooks = append(webhooks, map[string]interface{}{
+			"name": name,
+			"clientConfig": map[string][]byte{
+				"caBundle": cert,
+			},
+		})
+	}
+
+	patch := map[string]interface{}{
+		"webhooks": webhooks,
+	}
+
+	mergePatch, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	return c.Patch(ctx, whc, client.RawPatch(types.StrategicMergePatchType, mergePatch))
+}
@@ -0,0 +1,183 @@
+package watcher
+
+import (
+	"context"
+
+	"github.com/bakito/operator-utils/pkg/certs"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	arv1 "k8s.io/api/admissionregistration/v1"
+	arv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Webhooks", func() {
+	var (
+		c   client.Client
+		ctx context.Context
+		ca  []byte
+	)
+	noMatch := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "none"}}
+
+	webhook := func(name, service string) arv1.ValidatingWebhook {
+		return arv1.ValidatingWebhook{
+			Name: name,
+			ClientConfig: arv1.WebhookClientConfig{
+				Service: &arv1.ServiceReference{Namespace: "test-ns", Name: service},
+			},
+		}
+	}
+	vwc := func(name string, labels map[string]string, hooks ...arv1.ValidatingWebhook) *arv1.ValidatingWebhookConfiguration {
+		return &arv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Webhooks:   hooks,
+		}
+	}
+	// inject injects the ca cert into the v1 webhook configurations
+	inject := func(o certs.Options) (bool, error) {
+		oo := o.ApplyDefaults("test")
+		missing := false
+		for _, t := range []Target{MutatingWebhookTarget(oo), ValidatingWebhookTarget(oo)} {
+			m, err := t.Inject(ctx, c, ca)
+			if err != nil {
+				return missing, err
+			}
+			missing = missing || m
+		}
+		return missing, nil
+	}
+	caBundles := func(name string) map[string]string {
+		cfg := &arv1.ValidatingWebhookConfiguration{}
+		Ω(c.Get(ctx, types.NamespacedName{Name: name}, cfg)).ShouldNot(HaveOccurred())
+		result := map[string]string{}
+		for _, wh := range cfg.Webhooks {
+			result[wh.Name] = string(wh.ClientConfig.CABundle)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		ca = []byte("ca")
+		c = fake.NewClientBuilder().WithObjects(
+			vwc("by-name", nil, webhook("a.example.com", "test")),
+			vwc("by-label-1", map[string]string{"app": "test"}, webhook("b.example.com", "test")),
+			vwc("by-label-2", map[string]string{"app": "test"},
+				webhook("c.example.com", "test"),
+				webhook("d.example.com", "other"),
+			),
+			vwc("other", map[string]string{"app": "other"}, webhook("e.example.com", "test")),
+		).Build()
+	})
+
+	It("should patch the configurations selected by name and label", func() {
+		o := certs.Options{
+			MutatingWebhookConfigSelector:   noMatch,
+			ValidatingWebhookConfigNames:    []string{"by-name"},
+			ValidatingWebhookConfigSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}},
+		}
+
+		Ω(inject(o)).Should(BeFalse())
+
+		Ω(caBundles("by-name")).Should(Equal(map[string]string{"a.example.com": "ca"}))
+		Ω(caBundles("by-label-1")).Should(Equal(map[string]string{"b.example.com": "ca"}))
+		Ω(caBundles("by-label-2")).Should(Equal(map[string]string{"c.example.com": "ca", "d.example.com": "ca"}))
+		Ω(caBundles("other")).Should(Equal(map[string]string{"e.example.com": ""}))
+	})
+
+	It("should only patch the webhooks referencing the service", func() {
+		o := certs.Options{
+			MutatingWebhookConfigSelector:   noMatch,
+			ValidatingWebhookConfigSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}},
+			WebhookServiceName:              "test",
+			WebhookServiceNamespace:         "test-ns",
+		}
+
+		Ω(inject(o)).Should(BeFalse())
+
+		Ω(caBundles("by-label-2")).Should(Equal(map[string]string{"c.example.com": "ca", "d.example.com": ""}))
+	})
+
+	It("should only patch the webhooks with the configured names", func() {
+		o := certs.Options{
+			MutatingWebhookConfigSelector:   noMatch,
+			ValidatingWebhookConfigSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}},
+			WebhookNames:                    []string{"d.example.com"},
+		}
+
+		Ω(inject(o)).Should(BeFalse())
+
+		Ω(caBundles("by-label-1")).Should(Equal(map[string]string{"b.example.com": ""}))
+		Ω(caBundles("by-label-2")).Should(Equal(map[string]string{"c.example.com": "", "d.example.com": "ca"}))
+	})
+
+	It("should match the metadata of the watched configurations", func() {
+		t := ValidatingWebhookTarget(certs.Options{
+			ValidatingWebhookConfigName:     "by-name",
+			ValidatingWebhookConfigSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}},
+		})
+		meta := func(name string, labels map[string]string) client.Object {
+			return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+		}
+		Ω(t.Matches(meta("by-name", nil))).Should(BeTrue())
+		Ω(t.Matches(meta("by-label", map[string]string{"app": "test"}))).Should(BeTrue())
+		Ω(t.Matches(meta("other", map[string]string{"app": "other"}))).Should(BeFalse())
+	})
+
+	It("should fail if a required configuration is missing", func() {
+		o := certs.Options{ValidatingWebhookConfigNames: []string{"by-name"}}
+
+		_, err := inject(o)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should skip missing optional configurations", func() {
+		o := certs.Options{
+			MutatingWebhookConfigOptional:   true,
+			ValidatingWebhookConfigNames:    []string{"missing", "by-name"},
+			ValidatingWebhookConfigOptional: true,
+		}
+
+		Ω(inject(o)).Should(BeTrue())
+		Ω(caBundles("by-name")).Should(Equal(map[string]string{"a.example.com": "ca"}))
+	})
+
+	It("should skip missing configurations marked as optional by name", func() {
+		o := certs.Options{
+			MutatingWebhookConfigOptional:        true,
+			ValidatingWebhookConfigNames:         []string{"missing", "by-name"},
+			ValidatingWebhookConfigOptionalNames: []string{"missing"},
+		}
+		Ω(inject(o)).Should(BeTrue())
+		Ω(caBundles("by-name")).Should(Equal(map[string]string{"a.example.com": "ca"}))
+
+		o.ValidatingWebhookConfigNames = []string{"missing", "required"}
+		_, err := inject(o)
+		Ω(err).Should(MatchError(ContainSubstring(`"required" not found`)))
+	})
+
+	It("should inject the ca cert into legacy v1beta1 configurations", func() {
+		c = fake.NewClientBuilder().WithObjects(&arv1beta1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy"},
+			Webhooks:   []arv1beta1.ValidatingWebhook{{Name: "a.example.com"}},
+		}).Build()
+		o := certs.Options{
+			MutatingWebhookConfigSelector: noMatch,
+			ValidatingWebhookConfigNames:  []string{"legacy"},
+			LegacyWebhookV1beta1:          true,
+		}
+		targets := defaultTargets(o.ApplyDefaults("test"))
+		Ω(targets[1].Object().GetObjectKind().GroupVersionKind().GroupVersion()).Should(Equal(arv1beta1.SchemeGroupVersion))
+
+		for _, t := range targets {
+			Ω(t.Inject(ctx, c, ca)).Should(BeFalse())
+		}
+
+		cfg := &arv1beta1.ValidatingWebhookConfiguration{}
+		Ω(c.Get(ctx, types.NamespacedName{Name: "legacy"}, cfg)).ShouldNot(HaveOccurred())
+		Ω(cfg.Webhooks[0].ClientConfig.CABundle).Should(Equal(ca))
+	})
+})